@@ -2,51 +2,98 @@ package main
 
 import (
 	"io"
-	"log"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 )
 
 // error handler
+// リダイレクトせずにリクエストされたURLで正しいstatusを返す (manager/api/はjson)
 func errorHandler(err error, c echo.Context) {
 	code := http.StatusInternalServerError
-	errorMessage := "server error"
+	var message interface{}
 	if he, ok := err.(*echo.HTTPError); ok {
 		code = he.Code
-		errorMessage = he.Message.(string)
+		message = he.Message
+		if he.Internal != nil {
+			err = he.Internal
+		}
+	}
+	logger := requestLogger(c).With("status", code, "method", c.Request().Method, "path", c.Request().URL.Path)
+	if code >= http.StatusInternalServerError {
+		logger.Error("request error", "error", err)
+	} else {
+		logger.Info("request error", "error", err)
+	}
+	if c.Response().Committed {
+		return
+	}
+	if strings.HasPrefix(c.Request().URL.Path, settings.RootPath+settings.BackendURI+"manager/api/") {
+		// messageはstring以外(error, map等)の場合もある
+		if m, ok := message.(error); ok {
+			message = m.Error()
+		}
+		if message == nil || code >= http.StatusInternalServerError {
+			message = http.StatusText(code)
+		}
+		if err := c.JSON(code, map[string]interface{}{"error": message}); err != nil {
+			logger.Error("error response error", "error", err)
+		}
+		return
+	}
+	if err := renderError(c, code); err != nil {
+		logger.Error("error page render error", "error", err)
 	}
-	log.Print(errorMessage) // TODO:log周り全体的にちゃんと書く
-	c.Redirect(http.StatusFound, settings.RootPath+"error/"+strconv.Itoa(code))
 }
 
-// error action
-func errorAction(c echo.Context) error {
-	code, err := strconv.Atoi(c.Param("code"))
-	if err != nil {
-		code = http.StatusInternalServerError
-	}
+// render error page with status code
+// error_404.html等のstatus別のtemplateがある場合はそちらを使う
+func renderError(c echo.Context, code int) error {
 	errorMessage := "internal server error"
 	if code == http.StatusNotFound {
 		errorMessage = "not found"
 	} else if code == http.StatusBadRequest {
 		errorMessage = "Bad Request"
+	} else if code < http.StatusInternalServerError && http.StatusText(code) != "" {
+		errorMessage = http.StatusText(code)
+	}
+	name := "error.html"
+	if renderer, ok := c.Echo().Renderer.(*templateRenderer); ok && renderer.hasTemplate("error_"+strconv.Itoa(code)+".html") {
+		name = "error_" + strconv.Itoa(code) + ".html"
+	}
+	if c.Request().Method == http.MethodHead {
+		return c.NoContent(code)
 	}
-	return c.Render(code, "error.html", map[string]interface{}{
+	err := c.Render(code, name, map[string]interface{}{
 		"title":         strconv.Itoa(code),
 		"error_code":    strconv.Itoa(code),
 		"error_message": errorMessage,
 		"root_path":     settings.RootPath,
 	})
+	if err != nil && !c.Response().Committed {
+		return c.String(code, errorMessage)
+	}
+	return err
+}
+
+// error action (旧URLの互換用)
+func errorAction(c echo.Context) error {
+	code, err := strconv.Atoi(c.Param("code"))
+	if err != nil || http.StatusText(code) == "" || code < http.StatusBadRequest {
+		code = http.StatusInternalServerError
+	}
+	return renderError(c, code)
 }
 
 // index action
-func indexAction(c echo.Context) error {
-	entries, next, previous := getEntryList(0)
+func (s *server) indexAction(c echo.Context) error {
+	entries, next, previous := s.getEntryList(0)
 	if entries == nil {
-		return c.Redirect(http.StatusFound, settings.RootPath+"error/404")
+		return echo.NewHTTPError(http.StatusNotFound)
 	}
 	return c.Render(http.StatusOK, "multiple.html", map[string]interface{}{
 		"title":     "",
@@ -54,33 +101,35 @@ func indexAction(c echo.Context) error {
 		"entries":   entries,
 		"next":      next,
 		"previous":  previous,
-		"tags":      cacheTagsAll,
+		"tags":      s.getTagsAll(),
+		"archives":  s.getArchives(),
 	})
 }
 
 // entry action
-func entryAction(c echo.Context) error {
-	entryItem := getEntry(c.Param("entry_code"))
+func (s *server) entryAction(c echo.Context) error {
+	entryItem := s.getEntry(c.Param("entry_code"))
 	if entryItem.EntryID < 1 {
-		return c.Redirect(http.StatusFound, settings.RootPath+"error/404")
+		return echo.NewHTTPError(http.StatusNotFound)
 	}
 	return c.Render(http.StatusOK, "single.html", map[string]interface{}{
 		"title":     entryItem.Title,
 		"root_path": settings.RootPath,
 		"entry":     entryItem,
-		"tags":      cacheTagsAll,
+		"tags":      s.getTagsAll(),
+		"archives":  s.getArchives(),
 	})
 }
 
 // page action
-func pageAction(c echo.Context) error {
+func (s *server) pageAction(c echo.Context) error {
 	num, err := strconv.Atoi(c.Param("num"))
-	if err != nil {
-		return c.Redirect(http.StatusFound, settings.RootPath+"error/400")
+	if err != nil || num < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest)
 	}
-	entries, next, previous := getEntryList(num)
+	entries, next, previous := s.getEntryList(num)
 	if entries == nil {
-		return c.Redirect(http.StatusFound, settings.RootPath+"error/404")
+		return echo.NewHTTPError(http.StatusNotFound)
 	}
 	return c.Render(http.StatusOK, "multiple.html", map[string]interface{}{
 		"title":     "",
@@ -88,23 +137,50 @@ func pageAction(c echo.Context) error {
 		"entries":   entries,
 		"next":      next,
 		"previous":  previous,
-		"tags":      cacheTagsAll,
+		"tags":      s.getTagsAll(),
+		"archives":  s.getArchives(),
 	})
 }
 
-// tag action
-func tagAction(c echo.Context) error {
-	tagName := c.Param("tagName")
-	titleList := getTitleList(tagName)
+// tag action (tag/:tagName, tag/:tagName/page/:num)
+// tagNameはslug, 旧URLのタグ名の場合はslugのURLにredirect
+func (s *server) tagAction(c echo.Context) error {
+	page := 0
+	if param := c.Param("num"); param != "" {
+		num, err := strconv.Atoi(param)
+		if err != nil || num < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest)
+		}
+		page = num
+	}
+	param := tagParam(c)
+	tag, ok := s.findTagBySlug(param)
+	if !ok {
+		if tag, ok := s.getTagMetas()[param]; ok {
+			return c.Redirect(http.StatusMovedPermanently, s.tagPageURI(tag.Name, page))
+		}
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	titleList, next, previous := s.getTitleList(tag.Name, page)
 	if titleList == nil {
-		return c.Redirect(http.StatusFound, settings.RootPath+"error/404")
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	var parentTag *TagItem
+	if tag.Parent != "" {
+		parentTag = &TagItem{TagName: tag.Parent, TagURI: s.tagURI(tag.Parent)}
 	}
 	return c.Render(http.StatusOK, "tag_page.html", map[string]interface{}{
-		"title":     "tag : " + tagName,
-		"root_path": settings.RootPath,
-		"tagName":   tagName,
-		"titleList": titleList,
-		"tags":      cacheTagsAll,
+		"title":       "tag : " + tag.Name,
+		"root_path":   settings.RootPath,
+		"tagName":     tag.Name,
+		"description": tag.Description,
+		"parentTag":   parentTag,
+		"childTags":   s.childTags(tag.Name),
+		"titleList":   titleList,
+		"next":        next,
+		"previous":    previous,
+		"tags":        s.getTagsAll(),
+		"archives":    s.getArchives(),
 	})
 }
 
@@ -116,42 +192,181 @@ func backendLoginAction(c echo.Context) error {
 		errorMessage = "Invalid username or password."
 	} else if errQuery == "csrf" {
 		errorMessage = "Invalid csrf token."
+	} else if errQuery == "limit" {
+		errorMessage = "Too many failed login attempts. Please try again later."
+	} else if errQuery == "expired" {
+		errorMessage = "Login expired. Please log in again."
+	}
+	token, err := getToken(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
 	}
 	return c.Render(http.StatusOK, "login.html", map[string]interface{}{
-		"token":         getToken(c),
+		"token":         token,
 		"error_message": errorMessage,
 	})
 }
 
-// authentication action
-func authenticationAction(c echo.Context) error {
-	// csrf token check
-	if !isValidToken(c) {
-		return c.Redirect(http.StatusFound, settings.RootPath+settings.BackendURI+"?err=csrf")
+// invalid csrf token on login form
+func invalidLoginTokenAction(c echo.Context) error {
+	return c.Redirect(http.StatusFound, settings.RootPath+settings.BackendURI+"?err=csrf")
+}
+
+// authentication action (csrf token is checked by csrfMiddleware)
+// ipとusername毎の失敗回数でbackoff/lockoutし、その間はpasswordを確認しない
+func (s *server) authenticationAction(c echo.Context) error {
+	userName, remoteIP, now := c.FormValue("user"), c.RealIP(), time.Now()
+	reason, retryAt, err := s.loginLimiter.begin(remoteIP, userName, now)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+	if reason != "" {
+		loginAttemptsTotal.Inc(reason)
+		s.recordLoginFailure(c, userName, reason, now)
+		requestLogger(c).Warn("login throttled", "user", userName, "remote_ip", remoteIP, "reason", reason, "retry_at", retryAt)
+		return c.Redirect(http.StatusFound, settings.RootPath+settings.BackendURI+"?err=limit")
 	}
 	// loggedin
-	if allowUser(c.FormValue("user"), c.FormValue("password")) {
-		err := saveLoggedinSession(c)
+	if user, ok := s.allowUser(userName, c.FormValue("password")); ok {
+		// TOTPが有効な場合はcode入力後にログインする (失敗回数はcodeの確認後に戻す)
+		if user.TOTPSecret != "" {
+			if err := s.loginLimiter.refund(remoteIP, userName, now); err != nil {
+				requestLogger(c).Error("login throttle refund error", "user_id", user.UserID, "error", err)
+			}
+			if err := savePendingTOTPSession(c, user); err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+			}
+			loginAttemptsTotal.Inc("totp_required")
+			requestLogger(c).Info("password accepted, waiting for totp", "user_id", user.UserID, "remote_ip", remoteIP)
+			return c.Redirect(http.StatusFound, settings.RootPath+settings.BackendURI+"totp")
+		}
+		if err := s.loginLimiter.succeeded(remoteIP, userName, now); err != nil {
+			requestLogger(c).Error("login throttle reset error", "user_id", user.UserID, "error", err)
+		}
+		err := saveLoggedinSession(c, user)
 		if err != nil {
-			return c.Redirect(http.StatusFound, settings.RootPath+"error/500")
+			return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
 		}
+		loginAttemptsTotal.Inc("success")
+		requestLogger(c).Info("login succeeded", "user_id", user.UserID, "remote_ip", remoteIP)
 		return c.Redirect(http.StatusFound, settings.RootPath+settings.BackendURI+"manager/")
 	}
+	loginAttemptsTotal.Inc("failure")
+	s.recordLoginFailure(c, userName, LoginFailureInvalid, now)
+	requestLogger(c).Warn("login failed", "user", userName, "remote_ip", remoteIP)
 	return c.Redirect(http.StatusFound, settings.RootPath+settings.BackendURI+"?err=ac")
 }
 
+// second login step (TOTP or recovery code)
+func (s *server) totpLoginAction(c echo.Context) error {
+	if _, err := s.pendingTOTPUser(c); err != nil {
+		return c.Redirect(http.StatusFound, settings.RootPath+settings.BackendURI+"?err=expired")
+	}
+	errorMessage := ""
+	errQuery := c.QueryParam("err")
+	if errQuery == "code" {
+		errorMessage = "Invalid authentication code."
+	} else if errQuery == "csrf" {
+		errorMessage = "Invalid csrf token."
+	} else if errQuery == "limit" {
+		errorMessage = "Too many failed login attempts. Please try again later."
+	}
+	token, err := getToken(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+	return c.Render(http.StatusOK, "totp.html", map[string]interface{}{
+		"token":         token,
+		"error_message": errorMessage,
+	})
+}
+
+// invalid csrf token on totp form
+func invalidTOTPTokenAction(c echo.Context) error {
+	return c.Redirect(http.StatusFound, settings.RootPath+settings.BackendURI+"totp?err=csrf")
+}
+
+// totp authentication action (csrf token is checked by csrfMiddleware)
+// codeの失敗もpasswordと同じくip/username毎に数える
+func (s *server) totpAuthenticationAction(c echo.Context) error {
+	user, err := s.pendingTOTPUser(c)
+	if err == errTOTPPendingLogin {
+		return c.Redirect(http.StatusFound, settings.RootPath+settings.BackendURI+"?err=expired")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+	remoteIP, now := c.RealIP(), time.Now()
+	reason, retryAt, err := s.loginLimiter.begin(remoteIP, user.Name, now)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+	if reason != "" {
+		loginAttemptsTotal.Inc(reason)
+		s.recordLoginFailure(c, user.Name, reason, now)
+		requestLogger(c).Warn("login throttled", "user", user.Name, "remote_ip", remoteIP, "reason", reason, "retry_at", retryAt)
+		return c.Redirect(http.StatusFound, settings.RootPath+settings.BackendURI+"totp?err=limit")
+	}
+	user, err = s.verifySecondFactor(user, c.FormValue("code"))
+	if err == errTOTPInvalidCode {
+		if err := countPendingTOTPAttempt(c); err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+		}
+		loginAttemptsTotal.Inc("failure")
+		s.recordLoginFailure(c, user.Name, LoginFailureInvalidCode, now)
+		requestLogger(c).Warn("login failed", "user", user.Name, "remote_ip", remoteIP, "reason", LoginFailureInvalidCode)
+		return c.Redirect(http.StatusFound, settings.RootPath+settings.BackendURI+"totp?err=code")
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+	if err := s.loginLimiter.succeeded(remoteIP, user.Name, now); err != nil {
+		requestLogger(c).Error("login throttle reset error", "user_id", user.UserID, "error", err)
+	}
+	if err := saveLoggedinSession(c, user); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+	loginAttemptsTotal.Inc("success")
+	requestLogger(c).Info("login succeeded", "user_id", user.UserID, "remote_ip", remoteIP, "recovery_codes_left", len(user.RecoveryCodes))
+	return c.Redirect(http.StatusFound, settings.RootPath+settings.BackendURI+"manager/")
+}
+
+// record a failed login for the manager (getLoginFailures)
+func (s *server) recordLoginFailure(c echo.Context, userName, reason string, now time.Time) {
+	if err := s.loginLimiter.failed(c.RealIP(), userName, c.Request().UserAgent(), reason, now); err != nil {
+		requestLogger(c).Error("login failure record error", "error", err)
+	}
+}
+
+// logout action (csrf token is checked by csrfMiddleware)
+func logoutAction(c echo.Context) error {
+	userID := loggedinUserID(c)
+	if err := deleteSession(c); err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+	requestLogger(c).Info("logged out", "user_id", userID, "remote_ip", c.RealIP())
+	return c.Redirect(http.StatusFound, settings.RootPath+settings.BackendURI)
+}
+
 // manager action
-func managerAction(c echo.Context) error {
-	if !isLoggedin(c) {
+func (s *server) managerAction(c echo.Context) error {
+	if !s.isLoggedin(c) {
 		return c.Redirect(http.StatusFound, settings.RootPath+settings.BackendURI)
 	}
-	return c.Render(http.StatusOK, "manager.html", map[string]interface{}{})
+	// api POSTのX-CSRF-Tokenヘッダー用
+	token, err := getToken(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+	return c.Render(http.StatusOK, "manager.html", map[string]interface{}{
+		"token": token,
+	})
 }
 
 // api get method
-func apiGetAction(c echo.Context) error {
+func (s *server) apiGetAction(c echo.Context) error {
 	// loggedin check
-	if !isLoggedin(c) && !isDevelopment() {
+	if !s.isLoggedin(c) && !isDevelopment() {
 		return c.JSON(http.StatusUnauthorized, 0)
 	}
 	switch c.Param("param") {
@@ -159,19 +374,253 @@ func apiGetAction(c echo.Context) error {
 		type Res struct {
 			Entries []MongoEntries `json:"entries"`
 		}
-		log.Println("access")
-		return c.JSON(http.StatusOK, Res{Entries: getAllEntries()})
+		return c.JSON(http.StatusOK, Res{Entries: s.getAllEntries()})
+	case "getCsrfToken":
+		// POSTではX-CSRF-Tokenヘッダーにvalueを入れる (使用後はresponseのX-CSRF-Tokenヘッダーの新しいvalueを使う)
+		token, err := getToken(c)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+		}
+		return c.JSON(http.StatusOK, token)
+	case "getSessions":
+		// ログイン中のuserのsession一覧 ([session] Store = db / file のみ)
+		type Res struct {
+			Sessions []SessionItem `json:"sessions"`
+			Error    string        `json:"error"`
+		}
+		list, err := s.getSessionList(c)
+		if err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		return c.JSON(http.StatusOK, Res{Sessions: list})
+	case "getLoginFailures":
+		// 失敗したログインの記録と、backoff/lockout中のip/username (limit = 件数, 省略時は全て)
+		type Res struct {
+			Failures  []LoginFailure  `json:"failures"`
+			Throttles []LoginThrottle `json:"throttles"`
+			Error     string          `json:"error"`
+		}
+		limit, _ := strconv.Atoi(c.QueryParam("limit"))
+		failures, err := s.loginLimiter.store.FindLoginFailures(limit)
+		if err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		throttles, err := s.loginLimiter.store.FindLoginThrottles(time.Now())
+		if err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		return c.JSON(http.StatusOK, Res{Failures: failures, Throttles: throttles})
+	case "getTOTPStatus":
+		type Res struct {
+			TOTPStatus
+			Error string `json:"error"`
+		}
+		status, err := s.getTOTPStatus(c)
+		if err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		return c.JSON(http.StatusOK, Res{TOTPStatus: status})
+	case "getCacheStats":
+		type Res struct {
+			Caches []CacheStats `json:"caches"`
+		}
+		return c.JSON(http.StatusOK, Res{Caches: s.cacheStats()})
+	case "getTags":
+		type Res struct {
+			Tags []MongoTags `json:"tags"`
+		}
+		return c.JSON(http.StatusOK, Res{Tags: s.getTagMetaList()})
+	case "getEntry":
+		// 非公開のエントリも取得する (id or entryCode)
+		entry, err := s.getEntryForManager(c.QueryParam("id"), c.QueryParam("entryCode"))
+		return entryResponse(c, entry, err)
+	case "getRevisions":
+		// id = entry id
+		type Res struct {
+			Revisions []MongoRevisions `json:"revisions"`
+			Error     string           `json:"error"`
+		}
+		revisions, err := s.getRevisions(c.QueryParam("id"))
+		if err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		return c.JSON(http.StatusOK, Res{Revisions: revisions})
+	case "diffRevisions":
+		// from, to = revision id
+		type Res struct {
+			Diff  string `json:"diff"`
+			Error string `json:"error"`
+		}
+		diff, err := s.diffRevisions(c.QueryParam("from"), c.QueryParam("to"))
+		if err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		return c.JSON(http.StatusOK, Res{Diff: diff})
 	}
 	return c.JSON(http.StatusForbidden, 0)
 }
 
 // api post method
-func apiPostAction(c echo.Context) error {
+func (s *server) apiPostAction(c echo.Context) error {
 	// loggedin check
-	if !isLoggedin(c) && !isDevelopment() {
+	if !s.isLoggedin(c) && !isDevelopment() {
 		return c.JSON(http.StatusUnauthorized, 0)
 	}
 	switch c.Param("param") {
+	case "createEntry", "updateEntry", "deleteEntry", "publishEntry", "unpublishEntry":
+		return s.apiEntryAction(c, c.Param("param"))
+	case "restoreRevision":
+		// {"revisionId": "..."}
+		var input struct {
+			RevisionID string `json:"revisionId"`
+		}
+		if err := c.Bind(&input); err != nil {
+			return c.JSON(http.StatusOK, entryRes{Error: err.Error()})
+		}
+		entry, err := s.restoreRevision(input.RevisionID, loggedinUserID(c))
+		return entryResponse(c, entry, err)
+	case "renameTag", "mergeTags", "deleteTag":
+		return s.apiTagAction(c, c.Param("param"))
+	case "saveTag":
+		// {"name": "タグ", "slug": "tag", "description": "...", "parent": "親タグ"}
+		type Res struct {
+			Tag   *MongoTags `json:"tag"`
+			Error string     `json:"error"`
+		}
+		var input TagMetaInput
+		if err := c.Bind(&input); err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		tag, err := s.saveTagMeta(input)
+		if err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		return c.JSON(http.StatusOK, Res{Tag: &tag})
+	case "revokeSession":
+		// {"id": "getSessionsのid"}
+		type Res struct {
+			Error string `json:"error"`
+		}
+		var input struct {
+			ID string `json:"id"`
+		}
+		if err := c.Bind(&input); err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		if err := s.revokeSession(c, input.ID); err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		requestLogger(c).Info("session revoked", "session", input.ID, "user_id", loggedinUserID(c))
+		return c.JSON(http.StatusOK, Res{})
+	case "unlockLogin":
+		// {"key": "ip:127.0.0.1" or "user:name"} (getLoginFailuresのthrottlesのkey)
+		type Res struct {
+			Error string `json:"error"`
+		}
+		var input struct {
+			Key string `json:"key"`
+		}
+		if err := c.Bind(&input); err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		if err := s.loginLimiter.unlock(input.Key); err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		requestLogger(c).Info("login unlocked", "key", input.Key, "user_id", loggedinUserID(c))
+		return c.JSON(http.StatusOK, Res{})
+	case "beginTOTP":
+		// secretとprovisioning uri, QRコード(png data uri)を返す. confirmTOTPで有効にする
+		type Res struct {
+			TOTPSetup
+			Error string `json:"error"`
+		}
+		setup, err := s.beginTOTP(c)
+		if err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		return c.JSON(http.StatusOK, Res{TOTPSetup: setup})
+	case "confirmTOTP", "regenerateRecoveryCodes":
+		// {"code": "123456"} recovery codesは平文で1回だけ返す
+		type Res struct {
+			RecoveryCodes []string `json:"recoveryCodes"`
+			Error         string   `json:"error"`
+		}
+		var input struct {
+			Code string `json:"code"`
+		}
+		if err := c.Bind(&input); err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		var codes []string
+		var err error
+		if c.Param("param") == "confirmTOTP" {
+			codes, err = s.confirmTOTP(c, input.Code)
+		} else {
+			codes, err = s.regenerateRecoveryCodes(c, input.Code)
+		}
+		if err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		requestLogger(c).Info(c.Param("param"), "user_id", loggedinUserID(c))
+		return c.JSON(http.StatusOK, Res{RecoveryCodes: codes})
+	case "disableTOTP":
+		// {"password": "...", "code": "123456 or recovery code"}
+		type Res struct {
+			Error string `json:"error"`
+		}
+		var input struct {
+			Password string `json:"password"`
+			Code     string `json:"code"`
+		}
+		if err := c.Bind(&input); err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		if err := s.disableTOTP(c, input.Password, input.Code); err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		requestLogger(c).Info("totp disabled", "user_id", loggedinUserID(c))
+		return c.JSON(http.StatusOK, Res{})
+	case "logoutAll":
+		// 現在のsessionを含む全てのsessionをログアウトする (成功後はログイン画面へ)
+		type Res struct {
+			Error string `json:"error"`
+		}
+		userID := loggedinUserID(c)
+		if err := s.logoutAll(c); err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		requestLogger(c).Info("logged out all sessions", "user_id", userID)
+		return c.JSON(http.StatusOK, Res{})
+	case "changePassword":
+		// {"currentPassword": "...", "newPassword": "..."} 他のsessionは全てログアウトする
+		type Res struct {
+			Error string `json:"error"`
+		}
+		var input struct {
+			CurrentPassword string `json:"currentPassword"`
+			NewPassword     string `json:"newPassword"`
+		}
+		if err := c.Bind(&input); err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		if err := s.changePassword(c, input.CurrentPassword, input.NewPassword); err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		requestLogger(c).Info("password changed", "user_id", loggedinUserID(c))
+		return c.JSON(http.StatusOK, Res{})
+	case "purgeCache":
+		// cache = entry/page/titleList/tags/feed/archive (空の場合は全て), key = 対象のkey (複数可, 空の場合は全て, titleListはtagName/page)
+		type Res struct {
+			Error string `json:"error"`
+		}
+		form, err := c.FormParams()
+		if err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		if err := s.purgeCache(form.Get("cache"), form["key"]); err != nil {
+			return c.JSON(http.StatusOK, Res{Error: err.Error()})
+		}
+		return c.JSON(http.StatusOK, Res{})
 	case "uploadImage":
 		uploadPath := "./files/images/"
 		uploadURI := settings.RootPath + "files/images/"
@@ -201,3 +650,71 @@ func apiPostAction(c echo.Context) error {
 	}
 	return c.JSON(http.StatusForbidden, 0)
 }
+
+// response of manager entry api
+type entryRes struct {
+	Entry *MongoEntries `json:"entry"`
+	Error string        `json:"error"`
+}
+
+func entryResponse(c echo.Context, entry MongoEntries, err error) error {
+	if err != nil {
+		return c.JSON(http.StatusOK, entryRes{Error: err.Error()})
+	}
+	return c.JSON(http.StatusOK, entryRes{Entry: &entry})
+}
+
+// create/update/delete/publish/unpublish entry (json body)
+func (s *server) apiEntryAction(c echo.Context, param string) error {
+	var input EntryInput
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusOK, entryRes{Error: err.Error()})
+	}
+	switch param {
+	case "createEntry":
+		entry, err := s.createEntry(input, loggedinUserID(c))
+		return entryResponse(c, entry, err)
+	case "updateEntry":
+		entry, err := s.updateEntry(input, loggedinUserID(c))
+		return entryResponse(c, entry, err)
+	case "publishEntry":
+		entry, err := s.setEntryPublished(input.ID, true, loggedinUserID(c))
+		return entryResponse(c, entry, err)
+	case "unpublishEntry":
+		entry, err := s.setEntryPublished(input.ID, false, loggedinUserID(c))
+		return entryResponse(c, entry, err)
+	case "deleteEntry":
+		if err := s.deleteEntry(input.ID); err != nil {
+			return c.JSON(http.StatusOK, entryRes{Error: err.Error()})
+		}
+		return c.JSON(http.StatusOK, entryRes{})
+	}
+	return c.JSON(http.StatusForbidden, 0)
+}
+
+// rename/merge/delete tag across all entries (json body)
+// renameTag: {"tag": "old", "to": "new"}, mergeTags: {"tags": ["a", "b"], "to": "c"}, deleteTag: {"tag": "name"}
+func (s *server) apiTagAction(c echo.Context, param string) error {
+	type Res struct {
+		Updated int    `json:"updated"`
+		Error   string `json:"error"`
+	}
+	var input TagInput
+	if err := c.Bind(&input); err != nil {
+		return c.JSON(http.StatusOK, Res{Error: err.Error()})
+	}
+	var updated int
+	var err error
+	switch param {
+	case "renameTag":
+		updated, err = s.renameTag(input, loggedinUserID(c))
+	case "mergeTags":
+		updated, err = s.mergeTags(input, loggedinUserID(c))
+	case "deleteTag":
+		updated, err = s.deleteTag(input, loggedinUserID(c))
+	}
+	if err != nil {
+		return c.JSON(http.StatusOK, Res{Error: err.Error()})
+	}
+	return c.JSON(http.StatusOK, Res{Updated: updated})
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// key of cacheArchive (overview)
+const cacheKeyArchivesAll = "all"
+
+// ArchiveItem - number of published entries in a month
+type ArchiveItem struct {
+	// first day of the month (site timezone)
+	Date  time.Time
+	URI   string
+	Count int
+}
+
+// archive/:year/ (month == 0) or archive/:year/:month/
+func archiveURI(year, month int) string {
+	if month == 0 {
+		return archivePrefixURI + strconv.Itoa(year) + "/"
+	}
+	return archivePrefixURI + strconv.Itoa(year) + "/" + fmt.Sprintf("%02d", month) + "/"
+}
+
+// per-month counts of published entries ordered by month desc
+func (s *server) getArchives() []ArchiveItem {
+	// cache exists check & return
+	generation := s.cacheArchive.Generation()
+	if val, ok := s.cacheArchive.Get(cacheKeyArchivesAll); ok {
+		return val.([]ArchiveItem)
+	}
+	var archives []ArchiveItem
+	entries, err := s.entries.FindPublished(time.Now(), 0, 0)
+	if err != nil {
+		appLog.Error("find published entries error", "error", err)
+		return archives
+	}
+	// publishDate descなので同じ月は連続する
+	for _, v := range entries {
+		t := v.PublishDate.In(siteLocation())
+		month := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, siteLocation())
+		if last := len(archives) - 1; last >= 0 && archives[last].Date.Equal(month) {
+			archives[last].Count++
+			continue
+		}
+		archives = append(archives, ArchiveItem{
+			Date:  month,
+			URI:   archiveURI(t.Year(), int(t.Month())),
+			Count: 1,
+		})
+	}
+	// save cache
+	s.cacheArchive.Set(cacheKeyArchivesAll, archives, generation)
+	return archives
+}
+
+// title list of published entries in the year (month == 0) or the month
+func (s *server) getArchiveTitleList(year, month int) []TitleList {
+	key := strconv.Itoa(year)
+	from := time.Date(year, time.January, 1, 0, 0, 0, 0, siteLocation())
+	to := from.AddDate(1, 0, 0)
+	if month > 0 {
+		key += fmt.Sprintf("-%02d", month)
+		from = time.Date(year, time.Month(month), 1, 0, 0, 0, 0, siteLocation())
+		to = from.AddDate(0, 1, 0)
+	}
+	// cache exists check & return
+	generation := s.cacheArchive.Generation()
+	if val, ok := s.cacheArchive.Get(key); ok {
+		return val.([]TitleList)
+	}
+	results, err := s.entries.FindPublishedBetween(from, to, time.Now())
+	if err != nil {
+		appLog.Error("find entries between error", "from", from, "to", to, "error", err)
+		return nil
+	}
+	titleList := s.toTitleList(results)
+	// save cache
+	s.cacheArchive.Set(key, titleList, generation)
+	return titleList
+}
+
+// archive action (archive/:year/, archive/:year/:month/)
+func (s *server) archiveAction(c echo.Context) error {
+	year, err := strconv.Atoi(c.Param("year"))
+	if err != nil || year < 1 || year > 9999 {
+		return echo.NewHTTPError(http.StatusBadRequest)
+	}
+	month := 0
+	if param := c.Param("month"); param != "" {
+		month, err = strconv.Atoi(param)
+		if err != nil || month < 1 || month > 12 {
+			return echo.NewHTTPError(http.StatusBadRequest)
+		}
+	}
+	titleList := s.getArchiveTitleList(year, month)
+	if titleList == nil {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	archiveName := strconv.Itoa(year)
+	if month > 0 {
+		archiveName = dateFormat(time.Date(year, time.Month(month), 1, 0, 0, 0, 0, siteLocation()), "month")
+	}
+	return c.Render(http.StatusOK, "archive.html", map[string]interface{}{
+		"title":       "archive : " + archiveName,
+		"root_path":   settings.RootPath,
+		"archiveName": archiveName,
+		"titleList":   titleList,
+		"tags":        s.getTagsAll(),
+		"archives":    s.getArchives(),
+	})
+}
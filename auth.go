@@ -1,9 +1,8 @@
 package main
 
 import (
+	"errors"
 	"net/http"
-
-	"math/rand"
 	"time"
 
 	"github.com/gorilla/sessions"
@@ -12,118 +11,229 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Token property
+// session keys
+// ログイン中はuser_idとissued_at(ログイン時刻), last_seen(idle timeout用), generation(MongoUsers.SessionGeneration)を持つ
 const (
-	TokenValueChars      = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ@!<>[]+=?/^~#,%.&{}()abcdefghijklmnopqrstuvwxyz"
-	TokenNameSessionKey  = "token_name"
-	TokenValueSessionKey = "token_value"
+	UserIDSessionKey     = "user_id"
+	IssuedAtSessionKey   = "issued_at"
+	LastSeenSessionKey   = "last_seen"
+	GenerationSessionKey = "generation"
 )
 
-// Token - form csrf token.
-type Token struct {
-	Name  string
-	Value string
-}
+// last_seen is saved at most once in this interval (リクエスト毎にsessionを保存しない)
+const sessionTouchInterval = time.Minute
+
+// password rules (bcryptは72byteまで)
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+var (
+	errNotLoggedin      = errors.New("not logged in")
+	errPasswordMismatch = errors.New("current password is incorrect")
+	errPasswordLength   = errors.New("password must be 8 to 72 bytes")
+)
 
 // sessions.Options
 func getSessionsOption() *sessions.Options {
 	return &sessions.Options{
 		Path:     settings.RootPath + settings.BackendURI,
-		MaxAge:   0,
+		MaxAge:   int(settings.SessionAbsoluteTimeout.Seconds()),
 		HttpOnly: true,
 		Secure:   !isDevelopment(), // 開発環境ではfalse
 		SameSite: http.SameSiteStrictMode,
 	}
 }
 
-// check csrf token
-func isValidToken(c echo.Context) bool {
+// session of the request
+// 削除されたkeyで署名されたcookie等は読めないので新しいsessionとして扱う
+func loadSession(c echo.Context) (*sessions.Session, error) {
 	ses, err := session.Get(settings.SessionName, c)
+	if err != nil && ses != nil {
+		requestLogger(c).Info("session is reset", "reason", err)
+		return ses, nil
+	}
+	return ses, err
+}
+
+// loggedin success
+func saveLoggedinSession(c echo.Context, user MongoUsers) error {
+	ses, err := loadSession(c)
+	if err != nil {
+		return err
+	}
+	// ログイン前のsession idを引き継がない (session fixation対策)
+	if st, ok := ses.Store().(*serverSessionStore); ok && ses.ID != "" {
+		if err := st.repo.DeleteSession(ses.ID); err != nil && err != errNotFound {
+			return err
+		}
+		ses.ID = ""
+	}
+	now := time.Now().Unix()
+	ses.Options = getSessionsOption()
+	ses.Values[UserIDSessionKey] = user.UserID
+	ses.Values[IssuedAtSessionKey] = now
+	ses.Values[LastSeenSessionKey] = now
+	ses.Values[GenerationSessionKey] = user.SessionGeneration
+	clearPendingTOTPSession(ses)
+	err = ses.Save(c.Request(), c.Response())
+	if err != nil {
+		requestLogger(c).Error("session save error", "user_id", user.UserID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// remove login values from the session (csrf tokenは残す)
+func clearLoggedinSession(ses *sessions.Session) {
+	for _, key := range []string{UserIDSessionKey, IssuedAtSessionKey, LastSeenSessionKey, GenerationSessionKey} {
+		delete(ses.Values, key)
+	}
+}
+
+// check loggedin
+// idle/absolute timeoutを過ぎたsessionと、generationが古いsession(password変更, 全sessionのlogout)はログアウトする
+func (s *server) isLoggedin(c echo.Context) bool {
+	ses, err := loadSession(c)
 	if err != nil {
-		// todo:logging
+		requestLogger(c).Warn("session load error", "error", err)
 		return false
 	}
-	sesTokenName := ses.Values[TokenNameSessionKey].(string)
-	sesTokenValue := ses.Values[TokenValueSessionKey].(string)
-	formCsrfTokenValue := c.FormValue(sesTokenName)
-	if formCsrfTokenValue == "" {
+	userID, _ := ses.Values[UserIDSessionKey].(int32)
+	if userID == 0 {
 		return false
 	}
-	if formCsrfTokenValue != sesTokenValue {
+	issuedAt, _ := ses.Values[IssuedAtSessionKey].(int64)
+	lastSeen, _ := ses.Values[LastSeenSessionKey].(int64)
+	generation, _ := ses.Values[GenerationSessionKey].(int32)
+	now := time.Now()
+	reason := ""
+	if now.After(time.Unix(issuedAt, 0).Add(settings.SessionAbsoluteTimeout)) {
+		reason = "absolute timeout"
+	} else if now.After(time.Unix(lastSeen, 0).Add(settings.SessionIdleTimeout)) {
+		reason = "idle timeout"
+	} else {
+		user, err := s.users.FindUserByID(userID)
+		if err == errNotFound {
+			reason = "user not found"
+		} else if err != nil {
+			requestLogger(c).Error("find user error", "user_id", userID, "error", err)
+			return false
+		} else if user.SessionGeneration != generation {
+			reason = "session generation changed"
+		}
+	}
+	if reason != "" {
+		requestLogger(c).Info("session expired", "user_id", userID, "reason", reason)
+		clearLoggedinSession(ses)
+		ses.Options = getSessionsOption()
+		if err := ses.Save(c.Request(), c.Response()); err != nil {
+			requestLogger(c).Error("session save error", "user_id", userID, "error", err)
+		}
 		return false
 	}
+	// IdleTimeoutが短い場合はその半分毎に保存する
+	if elapsed := now.Sub(time.Unix(lastSeen, 0)); elapsed >= sessionTouchInterval || elapsed >= settings.SessionIdleTimeout/2 {
+		ses.Values[LastSeenSessionKey] = now.Unix()
+		ses.Options = getSessionsOption()
+		if err := ses.Save(c.Request(), c.Response()); err != nil {
+			requestLogger(c).Error("session save error", "user_id", userID, "error", err)
+		}
+	}
 	return true
 }
 
-// csrf token - create/save and return
-func getToken(c echo.Context) Token {
-	var token Token
-	n, v := 64, 128
-	name := getChars(n)
-	value := getChars(v)
-	ses, _ := session.Get(settings.SessionName, c)
-	ses.Options = getSessionsOption()
-	token = Token{
-		Name:  name,
-		Value: value,
+// delete the session of the request (cookieも削除する)
+func deleteSession(c echo.Context) error {
+	ses, err := loadSession(c)
+	if err != nil {
+		return err
 	}
-	ses.Values[TokenNameSessionKey] = name
-	ses.Values[TokenValueSessionKey] = value
-	err := ses.Save(c.Request(), c.Response())
+	ses.Options = getSessionsOption()
+	ses.Options.MaxAge = -1
+	ses.Values = map[interface{}]interface{}{}
+	return ses.Save(c.Request(), c.Response())
+}
+
+// userId of loggedin user (0 if not loggedin)
+func loggedinUserID(c echo.Context) int32 {
+	ses, err := loadSession(c)
 	if err != nil {
-		// todo:logging
-		return token
+		return 0
 	}
-	return token
+	userID, _ := ses.Values[UserIDSessionKey].(int32)
+	return userID
 }
 
-// create token value
-func getChars(length int) string {
-	rand.Seed(time.Now().UnixNano() + int64(length))
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = TokenValueChars[rand.Int63()%int64(len(TokenValueChars))]
+// check account
+func (s *server) allowUser(name, password string) (MongoUsers, bool) {
+	user := s.getUser(name)
+	if user.Name == "" {
+		return user, false
 	}
-	return string(b)
+	err := bcrypt.CompareHashAndPassword([]byte(user.PassWord), []byte(password))
+	if err != nil {
+		return user, false
+	}
+	return user, true
 }
 
-// loggedin success
-func saveLoggedinSession(c echo.Context) error {
-	ses, _ := session.Get(settings.SessionName, c)
-	ses.Options = getSessionsOption()
-	ses.Values[settings.LoggedinKey] = settings.LoggedinValue
-	err := ses.Save(c.Request(), c.Response())
+// change the password of the loggedin user (他のsessionは全てログアウトする)
+func (s *server) changePassword(c echo.Context, currentPassword, newPassword string) error {
+	user, err := s.users.FindUserByID(loggedinUserID(c))
+	if err == errNotFound {
+		return errNotLoggedin
+	}
 	if err != nil {
-		// todo:logging
 		return err
 	}
-	return nil
+	if bcrypt.CompareHashAndPassword([]byte(user.PassWord), []byte(currentPassword)) != nil {
+		return errPasswordMismatch
+	}
+	if len(newPassword) < minPasswordLength || len(newPassword) > maxPasswordLength {
+		return errPasswordLength
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	user.PassWord = string(hash)
+	return s.renewUserSessions(c, user)
 }
 
-// check loggedin
-func isLoggedin(c echo.Context) bool {
-	ses, err := session.Get(settings.SessionName, c)
-	if err != nil {
-		// todo:logging
-		return false
+// save the user with a new session generation
+// 他のsessionは全て無効にし、現在のsessionは新しいgenerationで再発行する
+func (s *server) renewUserSessions(c echo.Context, user MongoUsers) error {
+	user.SessionGeneration++
+	if err := s.users.UpdateUser(user); err != nil {
+		return err
 	}
-	if val, ok := ses.Values[settings.LoggedinKey]; ok {
-		if val.(string) == settings.LoggedinValue {
-			return true
-		}
+	currentID := ""
+	if ses, err := loadSession(c); err == nil {
+		currentID = ses.ID
 	}
-	return false
+	if err := s.deleteUserSessions(user.UserID, currentID); err != nil {
+		return err
+	}
+	return saveLoggedinSession(c, user)
 }
 
-// check account
-func allowUser(name, password string) bool {
-	user := getUser(name)
-	if user.Name == "" {
-		return false
+// log out all sessions of the loggedin user (現在のsessionも含む)
+func (s *server) logoutAll(c echo.Context) error {
+	user, err := s.users.FindUserByID(loggedinUserID(c))
+	if err == errNotFound {
+		return errNotLoggedin
 	}
-	err := bcrypt.CompareHashAndPassword([]byte(user.PassWord), []byte(password))
 	if err != nil {
-		return false
+		return err
 	}
-	return true
+	user.SessionGeneration++
+	if err := s.users.UpdateUser(user); err != nil {
+		return err
+	}
+	if err := s.deleteUserSessions(user.UserID, ""); err != nil {
+		return err
+	}
+	return deleteSession(c)
 }
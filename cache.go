@@ -0,0 +1,152 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Cache - LRU cache safe for concurrent use, with optional TTL
+type Cache struct {
+	name       string
+	maxEntries int
+	ttl        time.Duration
+	mu         sync.Mutex
+	ll         *list.List
+	items      map[string]*list.Element
+	hits       uint64
+	misses     uint64
+	// Delete/Purgeで増やす. 読み込み前のgenerationと異なる場合はSetしない
+	// (破棄前にdbから読んだ古い値が破棄後に保存されないようにする)
+	generation uint64
+}
+
+// CacheStats - hit/miss counters of a Cache
+type CacheStats struct {
+	Name    string `json:"name"`
+	Size    int    `json:"size"`
+	MaxSize int    `json:"maxSize"`
+	Hits    uint64 `json:"hits"`
+	Misses  uint64 `json:"misses"`
+}
+
+type cacheItem struct {
+	key       string
+	value     interface{}
+	expiresAt time.Time
+}
+
+// maxEntries <= 0 は無制限, ttl <= 0 は期限なし
+func newCache(name string, maxEntries int, ttl time.Duration) *Cache {
+	return &Cache{
+		name:       name,
+		maxEntries: maxEntries,
+		ttl:        ttl,
+		ll:         list.New(),
+		items:      make(map[string]*list.Element),
+	}
+}
+
+// Get returns the cached value and true if it exists and is not expired
+func (c *Cache) Get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		item := el.Value.(*cacheItem)
+		if item.expiresAt.IsZero() || time.Now().Before(item.expiresAt) {
+			c.ll.MoveToFront(el)
+			atomic.AddUint64(&c.hits, 1)
+			return item.value, true
+		}
+		c.removeElement(el)
+	}
+	atomic.AddUint64(&c.misses, 1)
+	return nil, false
+}
+
+// Generation returns the current generation (値を読み込む前に取得してSetに渡す)
+func (c *Cache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// Set stores the value and evicts the least recently used one if full
+// generation is the value of Generation() before the value was loaded, the value is discarded if the cache was invalidated since then
+func (c *Cache) Set(key string, value interface{}, generation uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return false
+	}
+	var expiresAt time.Time
+	if c.ttl > 0 {
+		expiresAt = time.Now().Add(c.ttl)
+	}
+	if el, ok := c.items[key]; ok {
+		c.ll.MoveToFront(el)
+		item := el.Value.(*cacheItem)
+		item.value = value
+		item.expiresAt = expiresAt
+		return true
+	}
+	c.items[key] = c.ll.PushFront(&cacheItem{key: key, value: value, expiresAt: expiresAt})
+	if c.maxEntries > 0 && c.ll.Len() > c.maxEntries {
+		c.removeElement(c.ll.Back())
+	}
+	return true
+}
+
+// Delete removes the key
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// DeleteFunc removes keys whose value matches
+func (c *Cache) DeleteFunc(match func(key string, value interface{}) bool) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	deleted := 0
+	for key, el := range c.items {
+		if match(key, el.Value.(*cacheItem).value) {
+			c.removeElement(el)
+			deleted++
+		}
+	}
+	return deleted
+}
+
+// Purge removes all keys
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+}
+
+// Stats returns hit/miss counters
+func (c *Cache) Stats() CacheStats {
+	c.mu.Lock()
+	size := c.ll.Len()
+	c.mu.Unlock()
+	return CacheStats{
+		Name:    c.name,
+		Size:    size,
+		MaxSize: c.maxEntries,
+		Hits:    atomic.LoadUint64(&c.hits),
+		Misses:  atomic.LoadUint64(&c.misses),
+	}
+}
+
+func (c *Cache) removeElement(el *list.Element) {
+	c.ll.Remove(el)
+	delete(c.items, el.Value.(*cacheItem).key)
+}
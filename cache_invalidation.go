@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+// EntryWatcher - repositories which can notify entry changes (mongodb change stream)
+type EntryWatcher interface {
+	// blocks until ctx is done; entry is empty when the document was deleted
+	WatchEntries(ctx context.Context, onChange func(entry MongoEntries)) error
+}
+
+var errUnknownCache = errors.New("unknown cache")
+
+// cache name -> *Cache (name is same as CacheStats.Name)
+func (s *server) cacheByName(name string) (*Cache, error) {
+	for _, v := range []*Cache{s.cacheEntry, s.cachePage, s.cacheTitleList, s.cacheTags, s.cacheFeed, s.cacheArchive} {
+		if v.name == name {
+			return v, nil
+		}
+	}
+	return nil, errUnknownCache
+}
+
+// purge keys of the cache. name == "" purges every cache, keys == nil purges all keys
+func (s *server) purgeCache(name string, keys []string) error {
+	if name == "" {
+		s.cacheEntry.Purge()
+		s.cachePage.Purge()
+		s.cacheTitleList.Purge()
+		s.cacheTags.Purge()
+		s.cacheFeed.Purge()
+		s.cacheArchive.Purge()
+		return nil
+	}
+	cache, err := s.cacheByName(name)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		cache.Purge()
+		return nil
+	}
+	for _, key := range keys {
+		cache.Delete(key)
+	}
+	return nil
+}
+
+// purge caches affected by a written entry (before and after the change)
+func (s *server) invalidateEntry(entries ...MongoEntries) {
+	for _, entry := range entries {
+		if entry.EntryCode == "" {
+			// 削除等で内容が分からない場合は全て破棄
+			s.cacheEntry.Purge()
+			s.cacheTitleList.Purge()
+			continue
+		}
+		uri := settings.RootPath + entry.EntryCode
+		s.cacheEntry.Delete(entry.EntryCode)
+		// entryCodeが変更された場合は旧codeで残っているので破棄
+		s.cacheEntry.DeleteFunc(func(key string, value interface{}) bool {
+			return value.(EntryItem).EntryID == int(entry.EntryID)
+		})
+		// 1件変わるとタグの全ページで位置がずれるのでタグ単位で破棄
+		tagNames := make(map[string]bool)
+		for _, tagName := range entry.Tag {
+			tagNames[tagName] = true
+		}
+		// 外されたタグのリストにも残っているので含まれているタグも破棄
+		s.cacheTitleList.DeleteFunc(func(key string, value interface{}) bool {
+			for _, v := range value.(CacheTitleList).TitleList {
+				if v.URI == uri {
+					tagNames[key[:strings.LastIndex(key, "/")]] = true
+					return true
+				}
+			}
+			return false
+		})
+		s.cacheTitleList.DeleteFunc(func(key string, value interface{}) bool {
+			return tagNames[key[:strings.LastIndex(key, "/")]]
+		})
+	}
+	// 1件変わるとページ位置もタグ/月別件数もずれるのでpage/tags/feed/archiveは全て破棄
+	s.cachePage.Purge()
+	s.cacheTags.Purge()
+	s.cacheFeed.Purge()
+	s.cacheArchive.Purge()
+	s.searchIndex.Invalidate()
+	// publishDateが変わっている可能性があるので予約投稿の時刻を再計算
+	s.reschedule()
+}
+
+// purge caches on every change stream event until ctx is done
+func (s *server) watchEntries(ctx context.Context, watcher EntryWatcher) error {
+	return watcher.WatchEntries(ctx, func(entry MongoEntries) {
+		s.invalidateEntry(entry)
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheLRU(t *testing.T) {
+	c := newCache("test", 2, 0)
+	c.Set("a", 1, c.Generation())
+	c.Set("b", 2, c.Generation())
+	// aを使うとbが最も古くなる
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Fatalf("Get(a) = %v, %v", v, ok)
+	}
+	c.Set("c", 3, c.Generation())
+	tests := []struct {
+		key  string
+		want interface{}
+		ok   bool
+	}{
+		{"a", 1, true},
+		{"b", nil, false},
+		{"c", 3, true},
+	}
+	for _, tt := range tests {
+		if v, ok := c.Get(tt.key); ok != tt.ok || v != tt.want {
+			t.Errorf("Get(%s) = %v, %v, want %v, %v", tt.key, v, ok, tt.want, tt.ok)
+		}
+	}
+	stats := c.Stats()
+	if stats.Size != 2 || stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("Stats = %+v", stats)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := newCache("test", 0, 20*time.Millisecond)
+	c.Set("a", 1, c.Generation())
+	if _, ok := c.Get("a"); !ok {
+		t.Fatal("Get before expiry missed")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Fatal("Get after expiry hit")
+	}
+	if size := c.Stats().Size; size != 0 {
+		t.Errorf("expired item is kept, size = %d", size)
+	}
+}
+
+func TestCacheGeneration(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate func(c *Cache)
+	}{
+		{"Delete", func(c *Cache) { c.Delete("a") }},
+		{"DeleteFunc", func(c *Cache) { c.DeleteFunc(func(string, interface{}) bool { return true }) }},
+		{"Purge", func(c *Cache) { c.Purge() }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCache("test", 0, 0)
+			c.Set("a", "old", c.Generation())
+			// 破棄前に読み込みを始めたreader
+			generation := c.Generation()
+			tt.invalidate(c)
+			if c.Set("a", "stale", generation) {
+				t.Error("Set with the old generation succeeded")
+			}
+			if v, ok := c.Get("a"); ok {
+				t.Errorf("stale value is cached: %v", v)
+			}
+			if !c.Set("a", "new", c.Generation()) {
+				t.Error("Set with the current generation failed")
+			}
+		})
+	}
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/x/mongo/driver/connstring"
+	"gopkg.in/ini.v1"
+)
+
+// SettingsEnvPrefix - prefix of environment variables which override settings.ini
+const SettingsEnvPrefix = "DOBLOG_"
+
+// SettingsError - all problems found in settings.ini and environment variables
+type SettingsError struct {
+	Problems []string
+}
+
+func (e *SettingsError) Error() string {
+	return "invalid settings:\n  " + strings.Join(e.Problems, "\n  ")
+}
+
+// environment variable name of a key
+// [section] KeyName -> DOBLOG_SECTION_KEY_NAME (e.g. [db] DBPassword -> DOBLOG_DB_DB_PASSWORD)
+func settingsEnvName(section, key string) string {
+	var b strings.Builder
+	runes := []rune(key)
+	for i, r := range runes {
+		// 小文字->大文字, 連続した大文字の最後(DBPasswordのP)で区切る
+		if i > 0 && unicode.IsUpper(r) && (unicode.IsLower(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]))) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return SettingsEnvPrefix + strings.ToUpper(section) + "_" + b.String()
+}
+
+// settingsReader - reads keys of settings.ini (environment variables take precedence)
+// 解析できない値はdefaultにせずproblemsに溜めて最後にまとめて返す
+type settingsReader struct {
+	file     *ini.File
+	problems []string
+}
+
+// [section] Key (DOBLOG_SECTION_KEY)
+func settingsKeyName(section, key string) string {
+	return "[" + section + "] " + key + " (" + settingsEnvName(section, key) + ")"
+}
+
+func (r *settingsReader) addProblem(section, key, format string, args ...interface{}) {
+	r.problems = append(r.problems, settingsKeyName(section, key)+": "+fmt.Sprintf(format, args...))
+}
+
+// raw value, empty = not set (空の環境変数は未設定として扱い、ファイルの値を使う)
+func (r *settingsReader) value(section, key string) string {
+	if v := strings.TrimSpace(os.Getenv(settingsEnvName(section, key))); v != "" {
+		return v
+	}
+	return strings.TrimSpace(r.file.Section(section).Key(key).String())
+}
+
+func (r *settingsReader) String(section, key, def string) string {
+	if v := r.value(section, key); v != "" {
+		return v
+	}
+	return def
+}
+
+func (r *settingsReader) Int(section, key string, def int) int {
+	v := r.value(section, key)
+	if v == "" {
+		return def
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		r.addProblem(section, key, "%q is not an integer", v)
+		return def
+	}
+	return i
+}
+
+func (r *settingsReader) Bool(section, key string, def bool) bool {
+	v := r.value(section, key)
+	if v == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		r.addProblem(section, key, "%q is not a boolean (true/false)", v)
+		return def
+	}
+	return b
+}
+
+// e.g. 10m, 24h (0 is also allowed)
+func (r *settingsReader) Duration(section, key string, def time.Duration) time.Duration {
+	v := r.value(section, key)
+	if v == "" {
+		return def
+	}
+	if v == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		r.addProblem(section, key, "%q is not a duration (e.g. 30s, 10m, 24h)", v)
+		return def
+	}
+	return d
+}
+
+func (r *settingsReader) In(section, key, def string, candidates []string) string {
+	v := r.String(section, key, def)
+	for _, c := range candidates {
+		if v == c {
+			return v
+		}
+	}
+	r.addProblem(section, key, "%q must be one of %s", v, strings.Join(candidates, ", "))
+	return def
+}
+
+// comma separated base64 keys
+func (r *settingsReader) Keys(section, key string) [][]byte {
+	v := r.value(section, key)
+	if v == "" {
+		return nil
+	}
+	var keys [][]byte
+	for i, s := range strings.Split(v, ",") {
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+		if err != nil {
+			r.addProblem(section, key, "key %d is not base64", i+1)
+			continue
+		}
+		keys = append(keys, b)
+	}
+	return keys
+}
+
+// comma separated CIDRs (a single ip is /32 or /128)
+func (r *settingsReader) CIDRs(section, key string) []*net.IPNet {
+	v := r.value(section, key)
+	if v == "" {
+		return nil
+	}
+	var nets []*net.IPNet
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		cidr := s
+		if ip := net.ParseIP(s); ip != nil {
+			if ip.To4() != nil {
+				cidr += "/32"
+			} else {
+				cidr += "/128"
+			}
+		}
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			r.addProblem(section, key, "%q is not an ip address or CIDR", s)
+			continue
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}
+
+// load settings from the ini file and environment variables, and validate them
+// pathが空の場合は環境変数のみ
+func loadSettings(path string) (Settings, error) {
+	file := ini.Empty()
+	if path != "" {
+		var err error
+		if file, err = ini.Load(path); err != nil {
+			return Settings{}, fmt.Errorf("cannot read settings file %s: %v", path, err)
+		}
+	}
+	r := &settingsReader{file: file}
+	s := Settings{
+		HttpdPort:              r.String("app", "HttpdPort", ""),
+		ShutdownDelay:          r.Duration("app", "ShutdownDelay", 0),
+		TrustedProxies:         r.CIDRs("app", "TrustedProxies"),
+		BlogURL:                r.String("site", "BlogURL", ""),
+		BlogTitle:              r.String("site", "BlogTitle", "dobusarai/blog"),
+		BlogDescription:        r.String("site", "BlogDescription", "ブログ"),
+		FeedItems:              r.Int("site", "FeedItems", DefaultFeedItems),
+		RobotsFile:             r.String("site", "RobotsFile", ""),
+		RootPath:               r.String("site", "RootPath", "/"),
+		TimeZone:               r.String("site", "TimeZone", ""),
+		Locale:                 r.In("site", "Locale", "ja", []string{"ja", "en"}),
+		BackendURI:             r.String("site", "BackendURI", ""),
+		PagePerView:            r.Int("site", "PagePerView", 0),
+		TagPagePerView:         r.Int("site", "TagPagePerView", 0),
+		SessionName:            r.String("site", "SessionName", ""),
+		CSRFTokenTTL:           r.Duration("site", "CSRFTokenTTL", DefaultCSRFTokenTTL),
+		SessionStore:           r.In("session", "Store", SessionStoreCookie, []string{SessionStoreCookie, SessionStoreDB, SessionStoreFile}),
+		SessionDir:             r.String("session", "Dir", "./sessions"),
+		SessionIdleTimeout:     r.Duration("session", "IdleTimeout", DefaultSessionIdleTimeout),
+		SessionAbsoluteTimeout: r.Duration("session", "AbsoluteTimeout", DefaultSessionAbsoluteTimeout),
+		SessionAuthKeys:        r.Keys("session", "AuthKeys"),
+		SessionEncryptionKeys:  r.Keys("session", "EncryptionKeys"),
+		LoginBackoffBase:       r.Duration("login", "BackoffBase", time.Second),
+		LoginBackoffMax:        r.Duration("login", "BackoffMax", 5*time.Minute),
+		LoginLockoutThreshold:  r.Int("login", "LockoutThreshold", DefaultLoginLockoutThreshold),
+		LoginLockoutDuration:   r.Duration("login", "LockoutDuration", 15*time.Minute),
+		LoginHistorySize:       r.Int("login", "HistorySize", DefaultLoginHistorySize),
+		DBDriver:               r.In("db", "Driver", DriverMongoDB, []string{DriverMongoDB, DriverSQLite, DriverMemory}),
+		DBURI:                  r.String("db", "URI", ""),
+		DBPath:                 r.String("db", "DBPath", ""),
+		DBUser:                 r.String("db", "DBUser", ""),
+		DBPassword:             r.String("db", "DBPassword", ""),
+		DBName:                 r.String("db", "DBName", ""),
+		DBHost:                 r.String("db", "DBHost", ""),
+		DBPort:                 r.String("db", "DBPort", "27017"),
+		CacheSize:              r.Int("cache", "Size", DefaultCacheSize),
+		CacheTTL:               r.Duration("cache", "TTL", 0),
+		CacheWatch:             r.Bool("cache", "WatchChanges", false),
+		LogDir:                 r.String("log", "Dir", "./log"),
+		LogLevel:               r.In("log", "Level", "info", logLevelNames),
+		LogMaxSize:             r.Int("log", "MaxSize", DefaultLogMaxSize),
+		LogMaxBackups:          r.Int("log", "MaxBackups", DefaultLogMaxBackups),
+		LogRotateInterval:      r.Duration("log", "RotateInterval", 24*time.Hour),
+		MetricsEnabled:         r.Bool("metrics", "Enabled", false),
+		MetricsPort:            r.String("metrics", "Port", ""),
+	}
+	// timezone (空の場合はサーバーのlocal)
+	s.Location = time.Local
+	if s.TimeZone != "" {
+		loc, err := time.LoadLocation(s.TimeZone)
+		if err != nil {
+			r.addProblem("site", "TimeZone", "unknown timezone %q", s.TimeZone)
+		} else {
+			s.Location = loc
+		}
+	}
+	// URIにdatabaseがある場合はDBNameの代わりに使う
+	if s.DBURI != "" && s.DBName == "" {
+		if cs, err := connstring.Parse(s.DBURI); err == nil {
+			s.DBName = cs.Database
+		}
+	}
+	problems := r.problems
+	if err := validateSettings(s); err != nil {
+		problems = append(problems, err.(*SettingsError).Problems...)
+	}
+	if len(problems) > 0 {
+		return s, &SettingsError{Problems: problems}
+	}
+	// 未指定の場合はindexと同じ件数
+	if s.TagPagePerView == 0 {
+		s.TagPagePerView = s.PagePerView
+	}
+	return s, nil
+}
+
+// check values of settings, returns *SettingsError with all problems
+func validateSettings(s Settings) error {
+	r := &settingsReader{}
+	if !isValidListenAddr(s.HttpdPort) {
+		r.addProblem("app", "HttpdPort", "must be host:port, e.g. :9009 or 127.0.0.1:9009")
+	}
+	if s.ShutdownDelay < 0 {
+		r.addProblem("app", "ShutdownDelay", "must not be negative")
+	}
+	if u, err := url.Parse(s.BlogURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		r.addProblem("site", "BlogURL", "must be an absolute http(s) url, e.g. https://example.com")
+	}
+	if s.FeedItems < 1 {
+		r.addProblem("site", "FeedItems", "must be greater than 0")
+	}
+	if s.RobotsFile != "" {
+		if _, err := os.Stat(s.RobotsFile); err != nil {
+			r.addProblem("site", "RobotsFile", "cannot read %s", s.RobotsFile)
+		}
+	}
+	if !strings.HasPrefix(s.RootPath, "/") || !strings.HasSuffix(s.RootPath, "/") {
+		r.addProblem("site", "RootPath", "must start and end with '/'")
+	}
+	if s.BackendURI == "" || strings.HasPrefix(s.BackendURI, "/") || !strings.HasSuffix(s.BackendURI, "/") {
+		r.addProblem("site", "BackendURI", "required, must end with '/' and must not start with '/', e.g. backend/")
+	}
+	if s.PagePerView < 1 {
+		r.addProblem("site", "PagePerView", "must be greater than 0")
+	}
+	if s.TagPagePerView < 0 {
+		r.addProblem("site", "TagPagePerView", "must not be negative")
+	}
+	if s.SessionName == "" {
+		r.addProblem("site", "SessionName", "required")
+	}
+	if s.CSRFTokenTTL <= 0 {
+		r.addProblem("site", "CSRFTokenTTL", "must be greater than 0")
+	}
+	// 開発環境では空の場合にrandomなkeyを使う
+	if len(s.SessionAuthKeys) == 0 && !isDevelopment() {
+		r.addProblem("session", "AuthKeys", "required, e.g. generate with `openssl rand -base64 64`")
+	}
+	for i, v := range s.SessionAuthKeys {
+		if len(v) < 32 {
+			r.addProblem("session", "AuthKeys", "key %d must be at least 32 bytes", i+1)
+		}
+	}
+	if len(s.SessionEncryptionKeys) > len(s.SessionAuthKeys) {
+		r.addProblem("session", "EncryptionKeys", "must not have more keys than AuthKeys (keys are used in pairs)")
+	}
+	for i, v := range s.SessionEncryptionKeys {
+		if n := len(v); n != 16 && n != 24 && n != 32 {
+			r.addProblem("session", "EncryptionKeys", "key %d must be 16, 24 or 32 bytes", i+1)
+		}
+	}
+	if s.SessionIdleTimeout <= 0 {
+		r.addProblem("session", "IdleTimeout", "must be greater than 0")
+	}
+	if s.SessionAbsoluteTimeout < s.SessionIdleTimeout {
+		r.addProblem("session", "AbsoluteTimeout", "must not be shorter than IdleTimeout")
+	}
+	if s.SessionStore == SessionStoreFile && s.SessionDir == "" {
+		r.addProblem("session", "Dir", "required for store file")
+	}
+	if s.LoginBackoffBase <= 0 {
+		r.addProblem("login", "BackoffBase", "must be greater than 0")
+	}
+	if s.LoginBackoffMax < s.LoginBackoffBase {
+		r.addProblem("login", "BackoffMax", "must not be shorter than BackoffBase")
+	}
+	if s.LoginLockoutThreshold < 1 {
+		r.addProblem("login", "LockoutThreshold", "must be greater than 0")
+	}
+	if s.LoginLockoutDuration <= 0 {
+		r.addProblem("login", "LockoutDuration", "must be greater than 0")
+	}
+	if s.LoginHistorySize < 1 {
+		r.addProblem("login", "HistorySize", "must be greater than 0")
+	}
+	switch s.DBDriver {
+	case DriverSQLite, DriverMemory:
+		if s.DBPath == "" {
+			r.addProblem("db", "DBPath", "required for driver %s", s.DBDriver)
+		}
+	case DriverMongoDB:
+		if s.DBURI != "" {
+			// errorにURIを含めない (passwordが含まれる場合がある)
+			if _, err := connstring.ParseAndValidate(s.DBURI); err != nil {
+				r.addProblem("db", "URI", "invalid mongodb connection string")
+			}
+		} else if s.DBHost == "" {
+			r.addProblem("db", "DBHost", "required when URI is empty")
+		}
+		if s.DBName == "" {
+			r.addProblem("db", "DBName", "required (or database in URI)")
+		}
+	}
+	if s.CacheSize < 1 {
+		r.addProblem("cache", "Size", "must be greater than 0")
+	}
+	if s.CacheTTL < 0 {
+		r.addProblem("cache", "TTL", "must not be negative")
+	}
+	if s.LogDir == "" {
+		r.addProblem("log", "Dir", "required")
+	}
+	if s.LogMaxSize < 0 {
+		r.addProblem("log", "MaxSize", "must not be negative")
+	}
+	if s.LogMaxBackups < 0 {
+		r.addProblem("log", "MaxBackups", "must not be negative")
+	}
+	if s.LogRotateInterval < 0 {
+		r.addProblem("log", "RotateInterval", "must not be negative")
+	}
+	if s.MetricsPort != "" && !isValidListenAddr(s.MetricsPort) {
+		r.addProblem("metrics", "Port", "must be host:port, e.g. 127.0.0.1:9100")
+	}
+	if len(r.problems) > 0 {
+		return &SettingsError{Problems: r.problems}
+	}
+	return nil
+}
+
+// host:port (hostは省略可)
+func isValidListenAddr(addr string) bool {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	n, err := strconv.Atoi(port)
+	return err == nil && n >= 0 && n <= 65535
+}
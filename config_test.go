@@ -0,0 +1,104 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// set environment variables until the test ends
+func setTestEnv(t *testing.T, env map[string]string) {
+	t.Helper()
+	for k, v := range env {
+		old, ok := os.LookupEnv(k)
+		os.Setenv(k, v)
+		k := k
+		t.Cleanup(func() {
+			if ok {
+				os.Setenv(k, old)
+			} else {
+				os.Unsetenv(k)
+			}
+		})
+	}
+}
+
+func TestSettingsEnvName(t *testing.T) {
+	tests := []struct {
+		section, key, want string
+	}{
+		{"db", "DBPassword", "DOBLOG_DB_DB_PASSWORD"},
+		{"site", "PagePerView", "DOBLOG_SITE_PAGE_PER_VIEW"},
+		{"site", "CSRFTokenTTL", "DOBLOG_SITE_CSRF_TOKEN_TTL"},
+		{"app", "HttpdPort", "DOBLOG_APP_HTTPD_PORT"},
+		{"db", "URI", "DOBLOG_DB_URI"},
+	}
+	for _, tt := range tests {
+		if got := settingsEnvName(tt.section, tt.key); got != tt.want {
+			t.Errorf("settingsEnvName(%s, %s) = %s, want %s", tt.section, tt.key, got, tt.want)
+		}
+	}
+}
+
+func writeTestSettings(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "settings.ini")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadSettingsEnvOverride(t *testing.T) {
+	setTestEnv(t, map[string]string{
+		"DOBLOG_SITE_PAGE_PER_VIEW":   "7",
+		"DOBLOG_SESSION_IDLE_TIMEOUT": "30m",
+		"DOBLOG_DB_DB_PATH":           "  env.json  ",
+		// 空の場合はファイルの値
+		"DOBLOG_SITE_BLOG_TITLE": "",
+	})
+	s, err := loadSettings(writeTestSettings(t, testSettingsINI+"[site]\nBlogTitle = file title\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.PagePerView != 7 || s.SessionIdleTimeout != 30*time.Minute || s.DBPath != "env.json" || s.BlogTitle != "file title" {
+		t.Errorf("settings = PagePerView %d, IdleTimeout %s, DBPath %q, BlogTitle %q", s.PagePerView, s.SessionIdleTimeout, s.DBPath, s.BlogTitle)
+	}
+	// TagPagePerViewは未指定の場合PagePerViewと同じ
+	if s.TagPagePerView != 7 {
+		t.Errorf("TagPagePerView = %d", s.TagPagePerView)
+	}
+}
+
+func TestLoadSettingsProblems(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want []string
+	}{
+		{"not an integer", map[string]string{"DOBLOG_SITE_PAGE_PER_VIEW": "many"}, []string{"[site] PagePerView (DOBLOG_SITE_PAGE_PER_VIEW): \"many\" is not an integer", "must be greater than 0"}},
+		{"invalid duration", map[string]string{"DOBLOG_LOGIN_BACKOFF_MAX": "5 minutes"}, []string{"[login] BackoffMax"}},
+		{"not a candidate", map[string]string{"DOBLOG_DB_DRIVER": "mysql"}, []string{"[db] Driver (DOBLOG_DB_DRIVER): \"mysql\" must be one of mongodb, sqlite, memory"}},
+		{"all problems", map[string]string{"DOBLOG_SITE_ROOT_PATH": "blog", "DOBLOG_CACHE_SIZE": "0"}, []string{"[site] RootPath", "[cache] Size"}},
+		{"trusted proxies", map[string]string{"DOBLOG_APP_TRUSTED_PROXIES": "10.0.0.0/8, proxy"}, []string{"[app] TrustedProxies (DOBLOG_APP_TRUSTED_PROXIES): \"proxy\" is not an ip address or CIDR"}},
+		{"mongodb uri", map[string]string{"DOBLOG_DB_DRIVER": "mongodb", "DOBLOG_DB_URI": "mysql://x", "DOBLOG_DB_DB_NAME": "doblog"}, []string{"[db] URI"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setTestEnv(t, tt.env)
+			_, err := loadSettings(writeTestSettings(t, testSettingsINI))
+			settingsErr, ok := err.(*SettingsError)
+			if !ok {
+				t.Fatalf("err = %v", err)
+			}
+			message := settingsErr.Error()
+			for _, v := range tt.want {
+				if !strings.Contains(message, v) {
+					t.Errorf("%q does not contain %q", message, v)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// csrf token
+// <input type="hidden" name="(random文字列)" value="(random文字列)">の形式 (main.go参照)
+// jsonのapiはformの代わりにX-CSRF-Tokenヘッダーでvalueを送る
+const (
+	TokenNameSessionKey    = "token_name"
+	TokenValueSessionKey   = "token_value"
+	TokenExpiresSessionKey = "token_expires"
+	// request: token value for json api, response: next token after rotation
+	HeaderXCSRFToken = "X-CSRF-Token"
+	// random bytes (base64url encoded)
+	tokenNameBytes  = 24
+	tokenValueBytes = 32
+)
+
+// csrf check errors (logに出力する理由)
+var (
+	errTokenMissing  = errors.New("csrf token is missing")
+	errTokenExpired  = errors.New("csrf token is expired")
+	errTokenMismatch = errors.New("csrf token does not match")
+)
+
+// Token - form csrf token.
+type Token struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// random string from crypto/rand
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// csrf token - return the token in the session, create/save a new one if it is missing or expired
+func getToken(c echo.Context) (Token, error) {
+	ses, err := loadSession(c)
+	if err != nil {
+		return Token{}, err
+	}
+	name, _ := ses.Values[TokenNameSessionKey].(string)
+	value, _ := ses.Values[TokenValueSessionKey].(string)
+	expires, _ := ses.Values[TokenExpiresSessionKey].(int64)
+	if name != "" && value != "" && time.Now().Unix() < expires {
+		return Token{Name: name, Value: value}, nil
+	}
+	return rotateToken(c)
+}
+
+// create/save a new csrf token (the old token is no longer valid)
+func rotateToken(c echo.Context) (Token, error) {
+	name, err := randomToken(tokenNameBytes)
+	if err != nil {
+		return Token{}, err
+	}
+	value, err := randomToken(tokenValueBytes)
+	if err != nil {
+		return Token{}, err
+	}
+	ses, err := loadSession(c)
+	if err != nil {
+		return Token{}, err
+	}
+	ses.Options = getSessionsOption()
+	ses.Values[TokenNameSessionKey] = name
+	ses.Values[TokenValueSessionKey] = value
+	ses.Values[TokenExpiresSessionKey] = time.Now().Add(settings.CSRFTokenTTL).Unix()
+	if err := ses.Save(c.Request(), c.Response()); err != nil {
+		requestLogger(c).Error("session save error", "error", err)
+		return Token{}, err
+	}
+	return Token{Name: name, Value: value}, nil
+}
+
+// token in the session which is not expired
+func sessionToken(c echo.Context) (Token, error) {
+	ses, err := loadSession(c)
+	if err != nil {
+		return Token{}, err
+	}
+	name, _ := ses.Values[TokenNameSessionKey].(string)
+	value, _ := ses.Values[TokenValueSessionKey].(string)
+	expires, _ := ses.Values[TokenExpiresSessionKey].(int64)
+	if name == "" || value == "" {
+		return Token{}, errTokenMissing
+	}
+	if time.Now().Unix() >= expires {
+		return Token{}, errTokenExpired
+	}
+	return Token{Name: name, Value: value}, nil
+}
+
+// check csrf token (form value of the token name or X-CSRF-Token header)
+func checkToken(c echo.Context) error {
+	token, err := sessionToken(c)
+	if err != nil {
+		return err
+	}
+	requestValue := c.Request().Header.Get(HeaderXCSRFToken)
+	if requestValue == "" {
+		requestValue = c.FormValue(token.Name)
+	}
+	return compareToken(requestValue, token.Value)
+}
+
+// check csrf token for json api (X-CSRF-Token header only)
+func checkAPIToken(c echo.Context) error {
+	token, err := sessionToken(c)
+	if err != nil {
+		return err
+	}
+	return compareToken(c.Request().Header.Get(HeaderXCSRFToken), token.Value)
+}
+
+func compareToken(requestValue, value string) error {
+	if requestValue == "" {
+		return errTokenMissing
+	}
+	if subtle.ConstantTimeCompare([]byte(requestValue), []byte(value)) != 1 {
+		return errTokenMismatch
+	}
+	return nil
+}
+
+// csrf middleware for state-changing form requests (GET, HEAD, OPTIONS are not checked)
+// tokenは1回のみ有効で、確認した時点で使用済みになる (handlerが失敗した場合も同じ)
+// 新しいtokenはhandlerの前に保存し、X-CSRF-Tokenヘッダーで返す
+// onInvalid == nil の場合は403
+func csrfMiddleware(onInvalid echo.HandlerFunc) echo.MiddlewareFunc {
+	return tokenMiddleware(checkToken, onInvalid)
+}
+
+// csrf middleware for json api (X-CSRF-Token header only, 失敗時は403)
+// formと同じく1回のみ有効. managerのSPAはresponseのX-CSRF-Tokenヘッダーで次のtokenに更新する
+func apiCSRFMiddleware() echo.MiddlewareFunc {
+	return tokenMiddleware(checkAPIToken, nil)
+}
+
+func tokenMiddleware(check func(echo.Context) error, onInvalid echo.HandlerFunc) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			switch c.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return next(c)
+			}
+			if err := check(c); err != nil {
+				requestLogger(c).Warn("invalid csrf token", "remote_ip", c.RealIP(), "path", c.Request().URL.Path, "reason", err)
+				if onInvalid != nil {
+					return onInvalid(c)
+				}
+				return echo.NewHTTPError(http.StatusForbidden, "invalid csrf token")
+			}
+			token, err := rotateToken(c)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+			}
+			c.Response().Header().Set(HeaderXCSRFToken, token.Value)
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	formTokenPattern = regexp.MustCompile(`<input type="hidden" name="([^"]+)" value="([^"]+)"`)
+	metaTokenPattern = regexp.MustCompile(`<meta name="csrf-token" content="([^"]+)"`)
+)
+
+// user "admin" with the password "password"
+func testUser(t *testing.T) MongoUsers {
+	t.Helper()
+	return testNamedUser(t, 1, "admin")
+}
+
+// user with the password "password"
+func testNamedUser(t *testing.T, userID int32, name string) MongoUsers {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return MongoUsers{ID: primitive.NewObjectID(), UserID: userID, Name: name, PassWord: string(hash)}
+}
+
+// csrf token of the form in the page
+func formToken(t *testing.T, tc *testClient, path string) Token {
+	t.Helper()
+	m := formTokenPattern.FindStringSubmatch(tc.get(path).Body.String())
+	if m == nil {
+		t.Fatalf("%s has no csrf token", path)
+	}
+	return Token{Name: m[1], Value: m[2]}
+}
+
+func postForm(tc *testClient, path string, values url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(values.Encode()))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+	return tc.do(req)
+}
+
+// login as admin and return the client and the api token of the manager page
+func loginTestClient(t *testing.T, e *echo.Echo) (*testClient, string) {
+	t.Helper()
+	return loginTestClientAs(t, e, "admin")
+}
+
+// login as the user of testNamedUser
+func loginTestClientAs(t *testing.T, e *echo.Echo, name string) (*testClient, string) {
+	t.Helper()
+	tc := newTestClient(e)
+	token := formToken(t, tc, "/backend/")
+	rec := postForm(tc, "/backend/", url.Values{"user": {name}, "password": {"password"}, token.Name: {token.Value}})
+	if loc := rec.Header().Get(echo.HeaderLocation); loc != "/backend/manager/" {
+		t.Fatalf("login redirects to %q", loc)
+	}
+	m := metaTokenPattern.FindStringSubmatch(tc.get("/backend/manager/").Body.String())
+	if m == nil {
+		t.Fatal("manager page has no csrf token")
+	}
+	return tc, m[1]
+}
+
+func TestLoginFormCSRF(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    func(token Token) (string, string)
+		location string
+	}{
+		{"form value", func(token Token) (string, string) { return token.Name, token.Value }, "/backend/manager/"},
+		{"missing", func(token Token) (string, string) { return "", "" }, "/backend/?err=csrf"},
+		{"wrong value", func(token Token) (string, string) { return token.Name, "wrong" }, "/backend/?err=csrf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, e := newTestServer(t, newMemoryRepository(nil, []MongoUsers{testUser(t)}))
+			tc := newTestClient(e)
+			values := url.Values{"user": {"admin"}, "password": {"password"}}
+			if name, value := tt.value(formToken(t, tc, "/backend/")); name != "" {
+				values.Set(name, value)
+			}
+			rec := postForm(tc, "/backend/", values)
+			if loc := rec.Header().Get(echo.HeaderLocation); loc != tt.location {
+				t.Errorf("redirect = %q, want %q", loc, tt.location)
+			}
+		})
+	}
+}
+
+func TestLoginFormCSRFRotation(t *testing.T) {
+	_, e := newTestServer(t, newMemoryRepository(nil, []MongoUsers{testUser(t)}))
+	tc := newTestClient(e)
+	token := formToken(t, tc, "/backend/")
+	rec := postForm(tc, "/backend/", url.Values{"user": {"admin"}, "password": {"wrong"}, token.Name: {token.Value}})
+	if loc := rec.Header().Get(echo.HeaderLocation); loc != "/backend/?err=ac" {
+		t.Fatalf("redirect = %q", loc)
+	}
+	next := rec.Header().Get(HeaderXCSRFToken)
+	if next == "" || next == token.Value {
+		t.Fatalf("token is not rotated: %q", next)
+	}
+	// 使用済みのtokenは無効
+	rec = postForm(tc, "/backend/", url.Values{"user": {"admin"}, "password": {"password"}, token.Name: {token.Value}})
+	if loc := rec.Header().Get(echo.HeaderLocation); loc != "/backend/?err=csrf" {
+		t.Errorf("reused token: redirect = %q", loc)
+	}
+}
+
+func TestAPICSRF(t *testing.T) {
+	tests := []struct {
+		name   string
+		header func(token string) string
+		form   bool
+		status int
+	}{
+		{"header", func(token string) string { return token }, false, http.StatusOK},
+		{"missing", func(token string) string { return "" }, false, http.StatusForbidden},
+		{"wrong header", func(token string) string { return token + "x" }, false, http.StatusForbidden},
+		// apiはheaderのみ
+		{"form value", func(token string) string { return "" }, true, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, e := newTestServer(t, newMemoryRepository(nil, []MongoUsers{testUser(t)}))
+			tc, token := loginTestClient(t, e)
+			body := ""
+			if tt.form {
+				body = url.Values{"csrf": {token}}.Encode()
+			}
+			req := httptest.NewRequest(http.MethodPost, "/backend/manager/api/purgeCache", strings.NewReader(body))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationForm)
+			if v := tt.header(token); v != "" {
+				req.Header.Set(HeaderXCSRFToken, v)
+			}
+			if rec := tc.do(req); rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func postAPI(tc *testClient, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/backend/manager/api/purgeCache", nil)
+	req.Header.Set(HeaderXCSRFToken, token)
+	return tc.do(req)
+}
+
+// apiのtokenも1回のみ有効で、responseのX-CSRF-Tokenヘッダーで次のtokenを返す
+func TestAPICSRFRotation(t *testing.T) {
+	_, e := newTestServer(t, newMemoryRepository(nil, []MongoUsers{testUser(t)}))
+	tc, token := loginTestClient(t, e)
+	rec := postAPI(tc, token)
+	next := rec.Header().Get(HeaderXCSRFToken)
+	if rec.Code != http.StatusOK || next == "" || next == token {
+		t.Fatalf("status = %d, next token = %q", rec.Code, next)
+	}
+	if rec := postAPI(tc, token); rec.Code != http.StatusForbidden {
+		t.Errorf("reused token: status = %d", rec.Code)
+	}
+	if rec := postAPI(tc, next); rec.Code != http.StatusOK {
+		t.Errorf("next token: status = %d", rec.Code)
+	}
+}
+
+func TestAPICSRFExpired(t *testing.T) {
+	_, e := newTestServer(t, newMemoryRepository(nil, []MongoUsers{testUser(t)}))
+	tc, token := loginTestClient(t, e)
+	ttl := settings.CSRFTokenTTL
+	t.Cleanup(func() { settings.CSRFTokenTTL = ttl })
+	// 次のtokenは発行時に期限切れ
+	settings.CSRFTokenTTL = -time.Second
+	rec := postAPI(tc, token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	if rec := postAPI(tc, rec.Header().Get(HeaderXCSRFToken)); rec.Code != http.StatusForbidden {
+		t.Errorf("expired token: status = %d", rec.Code)
+	}
+}
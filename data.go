@@ -1,14 +1,11 @@
 package main
 
 import (
-	"context"
+	"net"
 	"strconv"
+	"time"
 
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
-	"gopkg.in/ini.v1"
 )
 
 // MongoUsers for get data from mongodb
@@ -17,6 +14,16 @@ type MongoUsers struct {
 	UserID   int32              `json:"userId" bson:"userId"`
 	Name     string             `json:"name" bson:"name"`
 	PassWord string             `json:"password" bson:"password"`
+	// password変更/全sessionのlogoutで増やす (古いgenerationのsessionは無効)
+	SessionGeneration int32 `json:"sessionGeneration" bson:"sessionGeneration"`
+	// TOTP two-factor authentication (TOTPSecretが空の場合は無効)
+	TOTPSecret string `json:"totpSecret" bson:"totpSecret"`
+	// enrollment中のsecret (confirmTOTPでTOTPSecretに移す)
+	TOTPPendingSecret string `json:"totpPendingSecret" bson:"totpPendingSecret"`
+	// last used time step (同じcodeを2回使えないようにする)
+	TOTPLastCounter int64 `json:"totpLastCounter" bson:"totpLastCounter"`
+	// sha256 hex of unused recovery codes
+	RecoveryCodes []string `json:"recoveryCodes" bson:"recoveryCodes"`
 }
 
 // MongoEntries for get data from mongodb
@@ -24,21 +31,54 @@ type MongoEntries struct {
 	ID          primitive.ObjectID `json:"id" bson:"_id"`
 	EntryID     int32              `json:"entryId" bson:"entryId"`
 	EntryCode   string             `json:"entryCode" bson:"entryCode"`
-	PublishDate string             `json:"publishDate" bson:"publishDate"`
+	PublishDate time.Time          `json:"publishDate" bson:"publishDate"`
 	Title       string             `json:"title" bson:"title"`
 	Content     string             `json:"content" bson:"content"`
 	Tag         []string           `json:"tag" bson:"tag"`
 	IsPublished int32              `json:"isPublished" bson:"isPublished"`
 	AuthorID    int32              `json:"authorId" bson:"authorId"`
-	CreatedAt   string             `json:"createdAt" bson:"createdAt"`
-	UpdatedAt   string             `json:"updatedAt" bson:"updatedAt"`
+	CreatedAt   time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt   time.Time          `json:"updatedAt" bson:"updatedAt"`
+}
+
+// MongoRevisions for entry revision history (snapshot of saved entry)
+type MongoRevisions struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id"`
+	EntryObjectID primitive.ObjectID `json:"entryObjectId" bson:"entryObjectId"`
+	Revision      int32              `json:"revision" bson:"revision"`
+	Entry         MongoEntries       `json:"entry" bson:"entry"`
+	SavedBy       int32              `json:"savedBy" bson:"savedBy"`
+	SavedAt       time.Time          `json:"savedAt" bson:"savedAt"`
+}
+
+// MongoTags for tag metadata (Name is the tag string stored in MongoEntries.Tag)
+type MongoTags struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id"`
+	Name        string             `json:"name" bson:"name"`
+	Slug        string             `json:"slug" bson:"slug"`
+	Description string             `json:"description" bson:"description"`
+	Parent      string             `json:"parent" bson:"parent"`
+}
+
+// MongoSessions for server-side sessions ([session] Store = db / file)
+type MongoSessions struct {
+	// random id (cookieにはsigned/encryptedで保存する)
+	ID     string `json:"-" bson:"_id"`
+	UserID int32  `json:"userId" bson:"userId"`
+	// session values encoded with the session keys
+	Data      string    `json:"-" bson:"data"`
+	RemoteIP  string    `json:"remoteIp" bson:"remoteIp"`
+	UserAgent string    `json:"userAgent" bson:"userAgent"`
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
 }
 
 // EntryItem for view
 type EntryItem struct {
 	EntryID     int
 	URI         string
-	PublishDate string
+	PublishDate time.Time
 	Title       string
 	Content     string
 	Tags        []TagItem
@@ -54,26 +94,63 @@ type TagItem struct {
 // TitleList for tag search
 type TitleList struct {
 	URI         string
-	PublishDate string
+	PublishDate time.Time
 	Title       string
 	Tags        []TagItem
 }
 
 // Settings struct
 type Settings struct {
-	HttpdPort     string
-	BlogURL       string
-	RootPath      string
-	BackendURI    string
-	PagePerView   int
-	SessionName   string
-	LoggedinKey   string
-	LoggedinValue string
-	DBUser        string
-	DBPassword    string
-	DBName        string
-	DBHost        string
-	DBPort        string
+	HttpdPort       string
+	BlogURL         string
+	BlogTitle       string
+	BlogDescription string
+	FeedItems       int
+	RobotsFile      string
+	RootPath        string
+	TimeZone        string
+	Location        *time.Location
+	Locale          string
+	BackendURI      string
+	PagePerView     int
+	TagPagePerView  int
+	SessionName     string
+	CSRFTokenTTL    time.Duration
+	SessionStore    string
+	SessionDir      string
+	// logged-in sessions expire after IdleTimeout without access or AbsoluteTimeout after login
+	SessionIdleTimeout     time.Duration
+	SessionAbsoluteTimeout time.Duration
+	// [login] backoff after failed logins and lockout
+	LoginBackoffBase      time.Duration
+	LoginBackoffMax       time.Duration
+	LoginLockoutThreshold int
+	LoginLockoutDuration  time.Duration
+	LoginHistorySize      int
+	// base64 decoded keys, first = current
+	SessionAuthKeys       [][]byte
+	SessionEncryptionKeys [][]byte
+	DBDriver              string
+	DBURI                 string
+	DBPath                string
+	DBUser                string
+	DBPassword            string
+	DBName                string
+	DBHost                string
+	DBPort                string
+	CacheSize             int
+	CacheTTL              time.Duration
+	CacheWatch            bool
+	LogDir                string
+	LogLevel              string
+	LogMaxSize            int
+	LogMaxBackups         int
+	LogRotateInterval     time.Duration
+	MetricsEnabled        bool
+	MetricsPort           string
+	ShutdownDelay         time.Duration
+	// [app] TrustedProxies (空の場合はX-Forwarded-Forを使わない)
+	TrustedProxies []*net.IPNet
 }
 
 // Paginator struct
@@ -89,125 +166,145 @@ type CacheEntries struct {
 	PreviousPaginator Paginator
 }
 
+// CacheTitleList struct
+type CacheTitleList struct {
+	TitleList         []TitleList
+	NextPaginator     Paginator
+	PreviousPaginator Paginator
+}
+
 // 定数
 const (
-	IsPublished      = 1
-	MoreLinkString   = "<!--more-->"
-	SettingsFilePath = "./settings.ini"
+	IsPublished         = 1
+	MoreLinkString      = "<!--more-->"
+	SettingsFilePath    = "./settings.ini"
+	DefaultCacheSize    = 1000
+	DefaultFeedItems    = 20
+	DefaultCSRFTokenTTL = 2 * time.Hour
+	// [session] IdleTimeout, AbsoluteTimeout
+	DefaultSessionIdleTimeout     = 2 * time.Hour
+	DefaultSessionAbsoluteTimeout = 24 * time.Hour
+	// [login] LockoutThreshold, HistorySize
+	DefaultLoginLockoutThreshold = 10
+	DefaultLoginHistorySize      = 200
+	// [log] MaxSize (MB), MaxBackups
+	DefaultLogMaxSize    = 100
+	DefaultLogMaxBackups = 14
+	// key of cacheTags
+	cacheKeyTagsAll = "all"
+)
+
+// [db] Driver
+const (
+	DriverMongoDB = "mongodb"
+	DriverSQLite  = "sqlite"
+	DriverMemory  = "memory"
 )
 
 // fields
 var (
 	// settings
 	settings Settings
-	// db context
-	ctx context.Context
-	// db object
-	client *mongo.Client
 	// pagenate URL prefix
 	paginatorPrefixURI string
 	tagPrefixURI       string
-	// cache tags
-	cacheTagsAll []TagItem
-	// cache entry (string = entryCode)
-	cacheEntry map[string]EntryItem
-	// cache entries for page (int = page)
-	cacheEntriesForPage map[int]CacheEntries
-	// cache titleList for tag page (string = tagName)
-	cacheTitleList map[string][]TitleList
+	archivePrefixURI   string
 )
 
-func initializeData() {
-	// settings
-	iniFile, err := ini.Load(SettingsFilePath)
+// load settings (-config) and link urls
+func initializeData(path string) error {
+	s, err := loadSettings(path)
 	if err != nil {
-		panic("ini load error")
-	}
-	settings = Settings{
-		HttpdPort:     iniFile.Section("app").Key("HttpdPort").String(),
-		BlogURL:       iniFile.Section("site").Key("BlogURL").String(),
-		RootPath:      iniFile.Section("site").Key("RootPath").String(),
-		BackendURI:    iniFile.Section("site").Key("BackendURI").String(),
-		PagePerView:   iniFile.Section("site").Key("PagePerView").MustInt(),
-		SessionName:   iniFile.Section("site").Key("SessionName").String(),
-		LoggedinKey:   iniFile.Section("site").Key("LoggedinKey").String(),
-		LoggedinValue: iniFile.Section("site").Key("LoggedinValue").String(),
-		DBUser:        iniFile.Section("db").Key("DBUser").String(),
-		DBPassword:    iniFile.Section("db").Key("DBPassword").String(),
-		DBName:        iniFile.Section("db").Key("DBName").String(),
-		DBHost:        iniFile.Section("db").Key("DBHost").String(),
-		DBPort:        iniFile.Section("db").Key("DBPort").String(),
+		return err
 	}
+	settings = s
 	// link urls
 	paginatorPrefixURI = settings.RootPath + "page/"
 	tagPrefixURI = settings.RootPath + "tag/"
-	// init DB
-	ctx = context.Background()
-	credential := options.Credential{
-		AuthSource: settings.DBName,
-		Username:   settings.DBUser,
-		Password:   settings.DBPassword,
+	archivePrefixURI = settings.RootPath + "archive/"
+	return nil
+}
+
+// convert tag names to view items
+func (s *server) toTagItems(names []string) []TagItem {
+	var tags []TagItem
+	for _, v := range names {
+		tags = append(tags, TagItem{TagName: v, TagURI: s.tagURI(v)})
 	}
-	uri := "mongodb://" + settings.DBHost + ":" + settings.DBPort
-	temp, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetAuth(credential))
-	if err != nil {
-		panic("db connect error")
+	return tags
+}
+
+// convert entry document to view item
+func (s *server) toEntryItem(entry MongoEntries) EntryItem {
+	return EntryItem{
+		EntryID:     int(entry.EntryID),
+		URI:         settings.RootPath + entry.EntryCode,
+		PublishDate: entry.PublishDate,
+		Title:       entry.Title,
+		Content:     entry.Content,
+		Tags:        s.toTagItems(entry.Tag),
 	}
-	client = temp
-	// init tag slice
-	getTagsAll()
-	// cache map init
-	cacheEntry = make(map[string]EntryItem)
-	cacheEntriesForPage = make(map[int]CacheEntries)
-	cacheTitleList = make(map[string][]TitleList)
 }
 
-func closeConnection() {
-	client.Disconnect(ctx)
+// convert entries to title list items
+func (s *server) toTitleList(entries []MongoEntries) []TitleList {
+	var titleList []TitleList
+	for _, result := range entries {
+		titleList = append(titleList, TitleList{
+			URI:         settings.RootPath + result.EntryCode,
+			PublishDate: result.PublishDate,
+			Title:       result.Title,
+			Tags:        s.toTagItems(result.Tag),
+		})
+	}
+	return titleList
 }
 
 // tag エントリから全てのカテゴリを抽出する(重複は無視)
-func getTagsAll() {
-	cacheTagsAll = nil
-	entries := client.Database(settings.DBName).Collection("entries")
-	cur, err := entries.Find(ctx, bson.D{})
+func (s *server) getTagsAll() []TagItem {
+	// cache exists check & return
+	generation := s.cacheTags.Generation()
+	if val, ok := s.cacheTags.Get(cacheKeyTagsAll); ok {
+		return val.([]TagItem)
+	}
+	var tagsAll []TagItem
+	entries, err := s.entries.FindPublished(time.Now(), 0, 0)
 	if err != nil {
-		return
+		appLog.Error("find published entries error", "error", err)
+		return tagsAll
 	}
-	defer cur.Close(ctx)
-	for cur.Next(ctx) {
-		var result MongoEntries
-		err := cur.Decode(&result)
-		if err != nil {
-			//log.Fatal(err)
-			continue
-		}
+	for _, result := range entries {
 		for _, name := range result.Tag {
 			// goにはin_array, List<T>.Containsみたいなものは無いみたいなので自前チェック
 			isExists := false
-			for idx := 0; idx < len(cacheTagsAll); idx++ {
-				if cacheTagsAll[idx].TagName == name {
+			for idx := 0; idx < len(tagsAll); idx++ {
+				if tagsAll[idx].TagName == name {
 					isExists = true
-					cacheTagsAll[idx].Count++
+					tagsAll[idx].Count++
 					break
 				}
 			}
 			if !isExists {
-				cacheTagsAll = append(cacheTagsAll, TagItem{
+				tagsAll = append(tagsAll, TagItem{
 					TagName: name,
-					TagURI:  tagPrefixURI + name,
+					TagURI:  s.tagURI(name),
 					Count:   1,
 				})
 			}
 		}
 	}
+	// save cache
+	s.cacheTags.Set(cacheKeyTagsAll, tagsAll, generation)
+	return tagsAll
 }
 
 // get entry item with paginator flag(next, previous)
-func getEntryList(page int) ([]EntryItem, Paginator, Paginator) {
+func (s *server) getEntryList(page int) ([]EntryItem, Paginator, Paginator) {
 	// cache exists check & return
-	if val, ok := cacheEntriesForPage[page]; ok {
-		return val.EntryItems, val.NextPaginator, val.PreviousPaginator
+	generation := s.cachePage.Generation()
+	if val, ok := s.cachePage.Get(strconv.Itoa(page)); ok {
+		cache := val.(CacheEntries)
+		return cache.EntryItems, cache.NextPaginator, cache.PreviousPaginator
 	}
 	// get entry list
 	nextPaginator := Paginator{}
@@ -222,153 +319,105 @@ func getEntryList(page int) ([]EntryItem, Paginator, Paginator) {
 	previousPaginator := Paginator{}
 	offset := page * settings.PagePerView
 	var entryItems []EntryItem
-	entries := client.Database(settings.DBName).Collection("entries")
 	// paginateのために1件多く取得する
-	findOption := options.Find().SetSort(bson.D{{Key: "publishDate", Value: -1}}).SetSkip(int64(offset)).SetLimit(int64(settings.PagePerView + 1))
-	cur, err := entries.Find(ctx, bson.D{{Key: "isPublished", Value: 1}}, findOption)
+	results, err := s.entries.FindPublished(time.Now(), offset, settings.PagePerView+1)
 	if err != nil {
-		//log.Fatal(err)
+		appLog.Error("find published entries error", "page", page, "error", err)
 		return entryItems, nextPaginator, previousPaginator
 	}
-	// findはスライス等で返ってこない - *Cursol型で返ってくるので下記のようにループ回して取得
 	// PagePerViewの値を超えて存在した場合、Paginater->Previousは有効になる
-	defer cur.Close(ctx)
-	index := 0
-	for cur.Next(ctx) {
+	for index, result := range results {
 		if index >= settings.PagePerView {
 			previousPaginator = Paginator{IsExists: true, URI: paginatorPrefixURI + strconv.Itoa(page+1)}
 			break
 		}
-		var result MongoEntries
-		err := cur.Decode(&result)
-		if err != nil {
-			//log.Fatal(err)
-			return entryItems, nextPaginator, previousPaginator
-		}
-		var tags []TagItem
-		for _, v := range result.Tag {
-			tags = append(tags, TagItem{TagName: v, TagURI: tagPrefixURI + v})
-		}
-		entryItems = append(entryItems, EntryItem{
-			EntryID:     int(result.EntryID),
-			URI:         settings.RootPath + result.EntryCode,
-			PublishDate: result.PublishDate,
-			Title:       result.Title,
-			Content:     result.Content,
-			Tags:        tags,
-		})
-		index++
+		entryItems = append(entryItems, s.toEntryItem(result))
 	}
 	// save cache
-	cacheEntriesForPage[page] = CacheEntries{EntryItems: entryItems, NextPaginator: nextPaginator, PreviousPaginator: previousPaginator}
+	s.cachePage.Set(strconv.Itoa(page), CacheEntries{EntryItems: entryItems, NextPaginator: nextPaginator, PreviousPaginator: previousPaginator}, generation)
 	return entryItems, nextPaginator, previousPaginator
 }
 
-func getEntry(entryCode string) EntryItem {
+func (s *server) getEntry(entryCode string) EntryItem {
 	// cache exists check & return
-	if val, ok := cacheEntry[entryCode]; ok {
-		return val
+	generation := s.cacheEntry.Generation()
+	if val, ok := s.cacheEntry.Get(entryCode); ok {
+		return val.(EntryItem)
 	}
 	// get entry
 	var entryItem EntryItem
-	entries := client.Database(settings.DBName).Collection("entries")
-	var result MongoEntries
-	err := entries.FindOne(ctx, bson.D{{Key: "entryCode", Value: entryCode}, {Key: "isPublished", Value: 1}}).Decode(&result)
+	result, err := s.entries.FindPublishedByCode(entryCode, time.Now())
 	if err != nil {
+		if err != errNotFound {
+			appLog.Error("find entry error", "entry_code", entryCode, "error", err)
+		}
 		return entryItem
 	}
-	var tags []TagItem
-	for _, v := range result.Tag {
-		tags = append(tags, TagItem{TagName: v, TagURI: tagPrefixURI + v})
-	}
-	entryItem = EntryItem{
-		EntryID:     int(result.EntryID),
-		URI:         settings.RootPath + result.EntryCode,
-		PublishDate: result.PublishDate,
-		Title:       result.Title,
-		Content:     result.Content,
-		Tags:        tags,
-	}
+	entryItem = s.toEntryItem(result)
 	// save cache
-	cacheEntry[entryCode] = entryItem
+	s.cacheEntry.Set(entryCode, entryItem, generation)
 	return entryItem
 }
 
-func getTitleList(tagName string) []TitleList {
+// cacheTitleList key (タグ名に'/'は使えないので区切りにする)
+func titleListCacheKey(tagName string, page int) string {
+	return tagName + "/" + strconv.Itoa(page)
+}
+
+// tag page uri (page 0 = tag/:tagName)
+func (s *server) tagPageURI(tagName string, page int) string {
+	if page == 0 {
+		return s.tagURI(tagName)
+	}
+	return s.tagURI(tagName) + "/page/" + strconv.Itoa(page)
+}
+
+// get title list of the tag with paginator flag(next, previous)
+func (s *server) getTitleList(tagName string, page int) ([]TitleList, Paginator, Paginator) {
 	// cache exists check & return
-	if val, ok := cacheTitleList[tagName]; ok {
-		return val
+	key := titleListCacheKey(tagName, page)
+	generation := s.cacheTitleList.Generation()
+	if val, ok := s.cacheTitleList.Get(key); ok {
+		cache := val.(CacheTitleList)
+		return cache.TitleList, cache.NextPaginator, cache.PreviousPaginator
 	}
-	// get title list
-	var titleList []TitleList
-	entries := client.Database(settings.DBName).Collection("entries")
-	findOption := options.Find().SetSort(bson.D{{Key: "publishDate", Value: -1}})
-	cur, err := entries.Find(ctx, bson.D{{Key: "tag", Value: tagName}, {Key: "isPublished", Value: 1}}, findOption)
+	nextPaginator := Paginator{}
+	if page > 0 {
+		nextPaginator = Paginator{IsExists: true, URI: s.tagPageURI(tagName, page-1)}
+	}
+	previousPaginator := Paginator{}
+	// paginateのために1件多く取得する
+	results, err := s.entries.FindPublishedByTag(tagName, time.Now(), page*settings.TagPagePerView, settings.TagPagePerView+1)
 	if err != nil {
-		//log.Fatal(err)
-		return titleList
+		appLog.Error("find entries by tag error", "tag", tagName, "page", page, "error", err)
+		return nil, nextPaginator, previousPaginator
 	}
-	defer cur.Close(ctx)
-	for cur.Next(ctx) {
-		var result MongoEntries
-		err := cur.Decode(&result)
-		if err != nil {
-			//log.Fatal(err)
-			return titleList
-		}
-		var tags []TagItem
-		for _, v := range result.Tag {
-			tags = append(tags, TagItem{TagName: v, TagURI: tagPrefixURI + v})
-		}
-		titleList = append(titleList, TitleList{
-			URI:         settings.RootPath + result.EntryCode,
-			PublishDate: result.PublishDate,
-			Title:       result.Title,
-			Tags:        tags,
-		})
+	if len(results) > settings.TagPagePerView {
+		previousPaginator = Paginator{IsExists: true, URI: s.tagPageURI(tagName, page+1)}
+		results = results[:settings.TagPagePerView]
 	}
+	titleList := s.toTitleList(results)
 	// save cache
-	cacheTitleList[tagName] = titleList
-	return titleList
+	s.cacheTitleList.Set(key, CacheTitleList{TitleList: titleList, NextPaginator: nextPaginator, PreviousPaginator: previousPaginator}, generation)
+	return titleList, nextPaginator, previousPaginator
 }
 
-func getAllEntries() []MongoEntries {
-	var allEntries []MongoEntries
-	entries := client.Database(settings.DBName).Collection("entries")
-	findOption := options.Find().SetSort(bson.D{{Key: "publishDate", Value: -1}})
-	cur, err := entries.Find(ctx, bson.D{}, findOption)
+func (s *server) getAllEntries() []MongoEntries {
+	// エラー時も取得できた分は返す
+	allEntries, err := s.entries.FindAll()
 	if err != nil {
-		return allEntries
-	}
-	defer cur.Close(ctx)
-	for cur.Next(ctx) {
-		var result MongoEntries
-		err := cur.Decode(&result)
-		if err != nil {
-			//log.Fatal(err)
-			return allEntries
-		}
-		allEntries = append(allEntries, result)
+		appLog.Error("find all entries error", "error", err)
 	}
 	return allEntries
 }
 
-func getUser(name string) MongoUsers {
-	var user MongoUsers
-	users := client.Database(settings.DBName).Collection("users")
-	findOption := options.Find().SetLimit(1)
-	cur, err := users.Find(ctx, bson.D{{Key: "name", Value: name}}, findOption)
+func (s *server) getUser(name string) MongoUsers {
+	user, err := s.users.FindUserByName(name)
 	if err != nil {
-		// logging!!
-		return user
-	}
-	defer cur.Close(ctx)
-	for cur.Next(ctx) {
-		err := cur.Decode(&user)
-		if err != nil {
-			//log.Fatal(err)
-			return user
+		if err != errNotFound {
+			appLog.Error("find user error", "name", name, "error", err)
 		}
+		return MongoUsers{}
 	}
 	return user
 }
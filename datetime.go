@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// DateTimeFormat - default input/output format of datetime (site timezone)
+const DateTimeFormat = "2006-01-02 15:04:05"
+
+// accepted formats of datetime strings (legacy data stored as string / manager input)
+var dateTimeLayouts = []string{
+	DateTimeFormat,
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006/01/02 15:04:05",
+	"2006/01/02 15:04",
+	"2006/01/02",
+}
+
+var errInvalidDateTime = errors.New("invalid datetime")
+
+// parse datetime string, timezone未指定の場合はsiteのtimezoneとして扱う
+func parseDateTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, siteLocation()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errInvalidDateTime
+}
+
+// [site] TimeZone (default: local)
+func siteLocation() *time.Location {
+	if settings.Location == nil {
+		return time.Local
+	}
+	return settings.Location
+}
+
+// named layouts for dateFormat (それ以外はgoのlayoutとしてそのまま使う)
+var namedDateLayouts = map[string]map[string]string{
+	"en": {
+		"date":     "2006-01-02",
+		"datetime": "2006-01-02 15:04",
+		"month":    "January 2006",
+		"long":     "January 2, 2006",
+		"full":     "Monday, January 2, 2006 15:04",
+		"rfc3339":  time.RFC3339,
+	},
+	"ja": {
+		"date":     "2006-01-02",
+		"datetime": "2006-01-02 15:04",
+		"month":    "2006年1月",
+		"long":     "2006年1月2日",
+		"full":     "2006年1月2日(Mon) 15:04",
+		"rfc3339":  time.RFC3339,
+	},
+}
+
+var (
+	jaWeekdays      = []string{"日曜日", "月曜日", "火曜日", "水曜日", "木曜日", "金曜日", "土曜日"}
+	jaWeekdaysShort = []string{"日", "月", "火", "水", "木", "金", "土"}
+)
+
+// format time in site timezone and locale
+// e.g. {{ dateFormat .PublishDate "long" }}, {{ dateFormat .PublishDate "2006/01/02" }}
+func dateFormat(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	locale := settings.Locale
+	if _, ok := namedDateLayouts[locale]; !ok {
+		locale = "en"
+	}
+	if named, ok := namedDateLayouts[locale][layout]; ok {
+		layout = named
+	}
+	t = t.In(siteLocation())
+	return t.Format(localizeLayout(layout, t, locale))
+}
+
+// 曜日/月の名前はgoのlayoutでは英語固定なので、layout中の該当部分を先に置き換える
+func localizeLayout(layout string, t time.Time, locale string) string {
+	if locale != "ja" {
+		return layout
+	}
+	// "1"はgoのlayoutで月(数字)になる
+	month := "1月"
+	return strings.NewReplacer(
+		"Monday", jaWeekdays[t.Weekday()],
+		"Mon", jaWeekdaysShort[t.Weekday()],
+		"January", month,
+		"Jan", month,
+	).Replace(layout)
+}
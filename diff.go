@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// lines of context around changes in unified diff
+const diffContextLines = 3
+
+// max size of the LCS table (lines of from * lines of to after the common prefix/suffix)
+// 超える場合はLCSを計算せず、変更範囲を全て削除+追加として出力する (memoryをO(n*m)使わないように)
+const maxDiffCells = 4 << 20
+
+type diffOp struct {
+	kind byte // ' ', '-', '+'
+	text string
+}
+
+// line based unified diff (LCS)
+func unifiedDiff(fromName, toName, from, to string) string {
+	ops := diffLines(splitLines(from), splitLines(to))
+	var b strings.Builder
+	// aPos/bPos[i] = number of from/to lines before ops[i]
+	aPos := make([]int, len(ops)+1)
+	bPos := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aPos[i+1], bPos[i+1] = aPos[i], bPos[i]
+		if op.kind != '+' {
+			aPos[i+1]++
+		}
+		if op.kind != '-' {
+			bPos[i+1]++
+		}
+	}
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		if b.Len() == 0 {
+			b.WriteString("--- " + fromName + "\n+++ " + toName + "\n")
+		}
+		// 変更箇所の間隔がcontext*2以内なら1つのhunkにまとめる
+		start := i - diffContextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for j := i; j < len(ops) && j-end <= diffContextLines*2+1; j++ {
+			if ops[j].kind != ' ' {
+				end = j
+			}
+		}
+		stop := end + diffContextLines + 1
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+		b.WriteString("@@ -" + hunkRange(aPos[start], aPos[stop]-aPos[start]) +
+			" +" + hunkRange(bPos[start], bPos[stop]-bPos[start]) + " @@\n")
+		for _, op := range ops[start:stop] {
+			b.WriteByte(op.kind)
+			b.WriteString(op.text + "\n")
+		}
+		i = stop
+	}
+	return b.String()
+}
+
+func hunkRange(pos, count int) string {
+	if count == 0 {
+		return strconv.Itoa(pos) + ",0"
+	}
+	if count == 1 {
+		return strconv.Itoa(pos + 1)
+	}
+	return strconv.Itoa(pos+1) + "," + strconv.Itoa(count)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(strings.ReplaceAll(s, "\r\n", "\n"), "\n"), "\n")
+}
+
+func diffLines(a, b []string) []diffOp {
+	// 共通の先頭/末尾はLCSの計算対象から外す
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	var ops []diffOp
+	for _, v := range a[:prefix] {
+		ops = append(ops, diffOp{kind: ' ', text: v})
+	}
+	ops = append(ops, lcsDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, v := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{kind: ' ', text: v})
+	}
+	return ops
+}
+
+// diff by LCS table (maxDiffCellsを超える場合は全て削除+追加)
+func lcsDiff(ma, mb []string) []diffOp {
+	var ops []diffOp
+	if len(ma)*len(mb) > maxDiffCells {
+		for _, v := range ma {
+			ops = append(ops, diffOp{kind: '-', text: v})
+		}
+		for _, v := range mb {
+			ops = append(ops, diffOp{kind: '+', text: v})
+		}
+		return ops
+	}
+	// lcs[i][j] = LCS length of ma[i:] and mb[j:]
+	lcs := make([][]int, len(ma)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(mb)+1)
+	}
+	for i := len(ma) - 1; i >= 0; i-- {
+		for j := len(mb) - 1; j >= 0; j-- {
+			if ma[i] == mb[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(ma) || j < len(mb) {
+		switch {
+		case i < len(ma) && j < len(mb) && ma[i] == mb[j]:
+			ops = append(ops, diffOp{kind: ' ', text: ma[i]})
+			i++
+			j++
+		case j >= len(mb) || (i < len(ma) && lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{kind: '-', text: ma[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{kind: '+', text: mb[j]})
+			j++
+		}
+	}
+	return ops
+}
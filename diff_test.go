@@ -0,0 +1,89 @@
+package main
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     string
+	}{
+		{"same", "a\nb\nc\n", "a\nb\nc\n", ""},
+		{"crlf only", "a\r\nb\r\n", "a\nb\n", ""},
+		{"from empty", "", "a\n", "--- old\n+++ new\n@@ -0,0 +1 @@\n+a\n"},
+		{"to empty", "a\nb\n", "", "--- old\n+++ new\n@@ -1,2 +0,0 @@\n-a\n-b\n"},
+		{"changed line", "a\nb\nc\n", "a\nx\nc\n", "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n"},
+		{
+			"separate hunks",
+			"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			"1\n2\nx\n4\n5\n6\n7\n8\n9\n10\ny\n12\n",
+			"--- old\n+++ new\n@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+x\n 4\n 5\n 6\n@@ -8,5 +8,5 @@\n 8\n 9\n 10\n-11\n+y\n 12\n",
+		},
+		{
+			"joined hunk",
+			"1\n2\n3\n4\n5\n6\n7\n8\n",
+			"1\nx\n3\n4\n5\n6\ny\n8\n",
+			"--- old\n+++ new\n@@ -1,8 +1,8 @@\n 1\n-2\n+x\n 3\n 4\n 5\n 6\n-7\n+y\n 8\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("old", "new", tt.from, tt.to); got != tt.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// ops applied to from must give to
+func applyDiffOps(ops []diffOp) (from, to []string) {
+	for _, op := range ops {
+		if op.kind != '+' {
+			from = append(from, op.text)
+		}
+		if op.kind != '-' {
+			to = append(to, op.text)
+		}
+	}
+	return from, to
+}
+
+func TestDiffLines(t *testing.T) {
+	// 共通部分の後に大きな変更 (LCSの上限を超える)
+	var large, largeChanged []string
+	for i := 0; i < 3000; i++ {
+		large = append(large, "a"+strconv.Itoa(i))
+		largeChanged = append(largeChanged, "b"+strconv.Itoa(i))
+	}
+	tests := []struct {
+		name    string
+		a, b    []string
+		changes int
+	}{
+		{"insert", []string{"a", "c"}, []string{"a", "b", "c"}, 1},
+		{"delete", []string{"a", "b", "c"}, []string{"a", "c"}, 1},
+		{"move", []string{"a", "b", "c"}, []string{"c", "a", "b"}, 2},
+		{"over the limit", append([]string{"head"}, large...), append([]string{"head"}, largeChanged...), 6000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ops := diffLines(tt.a, tt.b)
+			from, to := applyDiffOps(ops)
+			if !equalStrings(from, tt.a) || !equalStrings(to, tt.b) {
+				t.Fatalf("ops do not reproduce the input: %v", ops)
+			}
+			changes := 0
+			for _, op := range ops {
+				if op.kind != ' ' {
+					changes++
+				}
+			}
+			if changes != tt.changes {
+				t.Errorf("changes = %d, want %d", changes, tt.changes)
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EntryInput - request body of manager entry api
+type EntryInput struct {
+	ID          string   `json:"id"`
+	EntryCode   string   `json:"entryCode"`
+	PublishDate string   `json:"publishDate"`
+	Title       string   `json:"title"`
+	Content     string   `json:"content"`
+	Tag         []string `json:"tag"`
+	IsPublished int32    `json:"isPublished"`
+}
+
+// ValidationError - invalid EntryInput
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// entryCodeはURLの1セグメントになるので英数字と-_のみ許可
+var entryCodePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// entryCodes used by other routes (RootPath + xxx)
+func reservedEntryCodes() []string {
+	return []string{"page", "tag", "archive", "search", "error", "files", "metrics", "healthz", "readyz", strings.Trim(settings.BackendURI, "/")}
+}
+
+// entryCode prefixes used by other routes (sitemap-:num)
+var reservedEntryCodePrefixes = []string{"sitemap-"}
+
+// normalize and validate input (tags are trimmed and deduplicated)
+func validateEntryInput(input *EntryInput) error {
+	input.EntryCode = strings.TrimSpace(input.EntryCode)
+	input.Title = strings.TrimSpace(input.Title)
+	input.PublishDate = strings.TrimSpace(input.PublishDate)
+	if !entryCodePattern.MatchString(input.EntryCode) {
+		return &ValidationError{Field: "entryCode", Message: "only alphanumeric, '-' and '_' are allowed"}
+	}
+	for _, v := range reservedEntryCodes() {
+		if input.EntryCode == v {
+			return &ValidationError{Field: "entryCode", Message: "'" + v + "' is reserved"}
+		}
+	}
+	for _, v := range reservedEntryCodePrefixes {
+		if strings.HasPrefix(input.EntryCode, v) {
+			return &ValidationError{Field: "entryCode", Message: "'" + v + "' is reserved"}
+		}
+	}
+	if input.Title == "" {
+		return &ValidationError{Field: "title", Message: "required"}
+	}
+	if _, err := parseDateTime(input.PublishDate); err != nil {
+		return &ValidationError{Field: "publishDate", Message: "must be formatted as " + DateTimeFormat}
+	}
+	var tags []string
+	for _, v := range input.Tag {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		if strings.Contains(v, "/") {
+			return &ValidationError{Field: "tag", Message: "'/' is not allowed"}
+		}
+		isExists := false
+		for _, t := range tags {
+			if t == v {
+				isExists = true
+				break
+			}
+		}
+		if !isExists {
+			tags = append(tags, v)
+		}
+	}
+	input.Tag = tags
+	if input.IsPublished != IsPublished {
+		input.IsPublished = 0
+	}
+	return nil
+}
+
+// parse EntryInput.ID
+func parseEntryID(id string) (primitive.ObjectID, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return objectID, &ValidationError{Field: "id", Message: "invalid id"}
+	}
+	return objectID, nil
+}
+
+// check entryCode is not used by other entry
+func (s *server) checkEntryCodeUnique(entryCode string, id primitive.ObjectID) error {
+	other, err := s.entries.FindByCode(entryCode)
+	if err == errNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if other.ID != id {
+		return &ValidationError{Field: "entryCode", Message: "already used"}
+	}
+	return nil
+}
+
+// get an entry including unpublished (id or entryCode)
+func (s *server) getEntryForManager(id, entryCode string) (MongoEntries, error) {
+	if id == "" {
+		return s.entries.FindByCode(entryCode)
+	}
+	objectID, err := parseEntryID(id)
+	if err != nil {
+		return MongoEntries{}, err
+	}
+	return s.entries.FindByID(objectID)
+}
+
+// create a new entry
+func (s *server) createEntry(input EntryInput, authorID int32) (MongoEntries, error) {
+	if err := validateEntryInput(&input); err != nil {
+		return MongoEntries{}, err
+	}
+	if err := s.checkEntryCodeUnique(input.EntryCode, primitive.NilObjectID); err != nil {
+		return MongoEntries{}, err
+	}
+	entryID, err := s.entries.NextEntryID()
+	if err != nil {
+		return MongoEntries{}, err
+	}
+	publishDate, _ := parseDateTime(input.PublishDate)
+	now := time.Now()
+	entry := MongoEntries{
+		ID:          primitive.NewObjectID(),
+		EntryID:     entryID,
+		EntryCode:   input.EntryCode,
+		PublishDate: publishDate,
+		Title:       input.Title,
+		Content:     input.Content,
+		Tag:         input.Tag,
+		IsPublished: input.IsPublished,
+		AuthorID:    authorID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := s.entries.Insert(entry); err != nil {
+		return MongoEntries{}, err
+	}
+	s.invalidateEntry(entry)
+	s.saveRevisionOrLog(entry, authorID)
+	return entry, nil
+}
+
+// update an entry (authorId and createdAt are kept)
+func (s *server) updateEntry(input EntryInput, savedBy int32) (MongoEntries, error) {
+	id, err := parseEntryID(input.ID)
+	if err != nil {
+		return MongoEntries{}, err
+	}
+	if err := validateEntryInput(&input); err != nil {
+		return MongoEntries{}, err
+	}
+	before, err := s.entries.FindByID(id)
+	if err != nil {
+		return MongoEntries{}, err
+	}
+	if err := s.checkEntryCodeUnique(input.EntryCode, id); err != nil {
+		return MongoEntries{}, err
+	}
+	entry := before
+	entry.EntryCode = input.EntryCode
+	entry.PublishDate, _ = parseDateTime(input.PublishDate)
+	entry.Title = input.Title
+	entry.Content = input.Content
+	entry.Tag = input.Tag
+	entry.IsPublished = input.IsPublished
+	entry.UpdatedAt = time.Now()
+	if err := s.entries.Update(entry); err != nil {
+		return MongoEntries{}, err
+	}
+	s.invalidateEntry(before, entry)
+	s.saveRevisionOrLog(entry, savedBy, before)
+	return entry, nil
+}
+
+// publish/unpublish an entry
+func (s *server) setEntryPublished(id string, isPublished bool, savedBy int32) (MongoEntries, error) {
+	objectID, err := parseEntryID(id)
+	if err != nil {
+		return MongoEntries{}, err
+	}
+	before, err := s.entries.FindByID(objectID)
+	if err != nil {
+		return MongoEntries{}, err
+	}
+	entry := before
+	entry.IsPublished = 0
+	if isPublished {
+		entry.IsPublished = IsPublished
+	}
+	entry.UpdatedAt = time.Now()
+	if err := s.entries.Update(entry); err != nil {
+		return MongoEntries{}, err
+	}
+	s.invalidateEntry(before, entry)
+	s.saveRevisionOrLog(entry, savedBy, before)
+	return entry, nil
+}
+
+// delete an entry
+func (s *server) deleteEntry(id string) error {
+	objectID, err := parseEntryID(id)
+	if err != nil {
+		return err
+	}
+	before, err := s.entries.FindByID(objectID)
+	if err != nil {
+		return err
+	}
+	if err := s.entries.Delete(objectID); err != nil {
+		return err
+	}
+	s.invalidateEntry(before)
+	return nil
+}
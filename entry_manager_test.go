@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestValidateEntryCode(t *testing.T) {
+	setupTestSettings(t, "")
+	tests := []struct {
+		entryCode string
+		valid     bool
+	}{
+		{"hello-world_1", true},
+		{"sitemaps", true},
+		{"my-sitemap-1", true},
+		{"", false},
+		{"hello world", false},
+		{"a.xml", false},
+		{"page", false},
+		{"search", false},
+		{"archive", false},
+		{"backend", false},
+		// sitemap-:numのrouteが優先される
+		{"sitemap-1", false},
+		{"sitemap-index", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.entryCode, func(t *testing.T) {
+			input := EntryInput{EntryCode: tt.entryCode, Title: "title", PublishDate: "2021-01-02 03:04:05"}
+			err := validateEntryInput(&input)
+			if tt.valid && err != nil {
+				t.Errorf("err = %v", err)
+			}
+			if !tt.valid {
+				if v, ok := err.(*ValidationError); !ok || v.Field != "entryCode" {
+					t.Errorf("err = %v, want entryCode error", err)
+				}
+			}
+		})
+	}
+}
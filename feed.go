@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// feed formats (also used as cacheFeed key prefix)
+const (
+	FeedRSS  = "rss"
+	FeedAtom = "atom"
+	FeedJSON = "json"
+)
+
+// feed content types
+const (
+	ContentTypeRSS      = "application/rss+xml; charset=utf-8"
+	ContentTypeAtom     = "application/atom+xml; charset=utf-8"
+	ContentTypeJSONFeed = "application/feed+json; charset=utf-8"
+)
+
+// RSS 2.0
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	AtomNS  string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string      `xml:"title"`
+	Link          string      `xml:"link"`
+	Description   string      `xml:"description"`
+	Language      string      `xml:"language,omitempty"`
+	AtomLink      rssAtomLink `xml:"atom:link"`
+	LastBuildDate string      `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem   `xml:"item"`
+}
+
+type rssAtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        rssGUID  `xml:"guid"`
+	PubDate     string   `xml:"pubDate"`
+	Categories  []string `xml:"category"`
+	Description string   `xml:"description"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+// Atom 1.0
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title      string         `xml:"title"`
+	ID         string         `xml:"id"`
+	Published  string         `xml:"published"`
+	Updated    string         `xml:"updated"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+	Content    atomContent    `xml:"content"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// JSON Feed 1.1
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Description string         `json:"description,omitempty"`
+	Language    string         `json:"language,omitempty"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedItem struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Title         string   `json:"title"`
+	ContentHTML   string   `json:"content_html"`
+	DatePublished string   `json:"date_published"`
+	DateModified  string   `json:"date_modified,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// absolute url of path (BlogURLのscheme + hostを使う, pathはRootPathから始まる)
+func absoluteURL(path string) string {
+	u, err := url.Parse(settings.BlogURL)
+	if err != nil || u.Host == "" {
+		return strings.TrimSuffix(settings.BlogURL, "/") + path
+	}
+	return u.Scheme + "://" + u.Host + path
+}
+
+// latest published entries for feed (tagName == "" for all)
+func (s *server) getFeedEntries(tagName string) ([]MongoEntries, error) {
+	if tagName == "" {
+		return s.entries.FindPublished(time.Now(), 0, settings.FeedItems)
+	}
+	return s.entries.FindPublishedByTag(tagName, time.Now(), 0, settings.FeedItems)
+}
+
+// feed title and links (tagName == "" for all)
+func (s *server) feedMeta(tagName string) (title, homeURI, feedPrefixURI string) {
+	if tagName == "" {
+		return settings.BlogTitle, settings.RootPath, settings.RootPath
+	}
+	tagURI := s.tagURI(tagName)
+	return settings.BlogTitle + " - tag : " + tagName, tagURI, tagURI + "/"
+}
+
+func feedContent(entry MongoEntries) string {
+	return string(toMarkdown(entry.Content, false, settings.RootPath+entry.EntryCode, entry.Title))
+}
+
+func (s *server) buildRSS(tagName string, entries []MongoEntries) ([]byte, error) {
+	title, homeURI, feedPrefixURI := s.feedMeta(tagName)
+	feed := rssFeed{
+		Version: "2.0",
+		AtomNS:  "http://www.w3.org/2005/Atom",
+		Channel: rssChannel{
+			Title:       title,
+			Link:        absoluteURL(homeURI),
+			Description: settings.BlogDescription,
+			Language:    settings.Locale,
+			AtomLink:    rssAtomLink{Href: absoluteURL(feedPrefixURI + "feed.xml"), Rel: "self", Type: "application/rss+xml"},
+		},
+	}
+	for i, v := range entries {
+		if i == 0 {
+			feed.Channel.LastBuildDate = v.PublishDate.Format(time.RFC1123Z)
+		}
+		link := absoluteURL(settings.RootPath + v.EntryCode)
+		feed.Channel.Items = append(feed.Channel.Items, rssItem{
+			Title:       v.Title,
+			Link:        link,
+			GUID:        rssGUID{IsPermaLink: true, Value: link},
+			PubDate:     v.PublishDate.Format(time.RFC1123Z),
+			Categories:  v.Tag,
+			Description: feedContent(v),
+		})
+	}
+	b, err := xml.Marshal(feed)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func (s *server) buildAtom(tagName string, entries []MongoEntries) ([]byte, error) {
+	title, homeURI, feedPrefixURI := s.feedMeta(tagName)
+	feed := atomFeed{
+		Title: title,
+		ID:    absoluteURL(homeURI),
+		Links: []atomLink{
+			{Href: absoluteURL(homeURI), Rel: "alternate", Type: "text/html"},
+			{Href: absoluteURL(feedPrefixURI + "atom.xml"), Rel: "self", Type: "application/atom+xml"},
+		},
+		Author: atomAuthor{Name: settings.BlogTitle},
+	}
+	var updated time.Time
+	for _, v := range entries {
+		link := absoluteURL(settings.RootPath + v.EntryCode)
+		entryUpdated := v.UpdatedAt
+		if entryUpdated.Before(v.PublishDate) {
+			entryUpdated = v.PublishDate
+		}
+		if entryUpdated.After(updated) {
+			updated = entryUpdated
+		}
+		var categories []atomCategory
+		for _, t := range v.Tag {
+			categories = append(categories, atomCategory{Term: t})
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:      v.Title,
+			ID:         link,
+			Published:  v.PublishDate.Format(time.RFC3339),
+			Updated:    entryUpdated.Format(time.RFC3339),
+			Links:      []atomLink{{Href: link, Rel: "alternate", Type: "text/html"}},
+			Categories: categories,
+			Content:    atomContent{Type: "html", Body: feedContent(v)},
+		})
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed.Updated = updated.Format(time.RFC3339)
+	b, err := xml.Marshal(feed)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func (s *server) buildJSONFeed(tagName string, entries []MongoEntries) ([]byte, error) {
+	title, homeURI, feedPrefixURI := s.feedMeta(tagName)
+	feed := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       title,
+		HomePageURL: absoluteURL(homeURI),
+		FeedURL:     absoluteURL(feedPrefixURI + "feed.json"),
+		Description: settings.BlogDescription,
+		Language:    settings.Locale,
+		Items:       []jsonFeedItem{},
+	}
+	for _, v := range entries {
+		link := absoluteURL(settings.RootPath + v.EntryCode)
+		item := jsonFeedItem{
+			ID:            link,
+			URL:           link,
+			Title:         v.Title,
+			ContentHTML:   feedContent(v),
+			DatePublished: v.PublishDate.Format(time.RFC3339),
+			Tags:          v.Tag,
+		}
+		if v.UpdatedAt.After(v.PublishDate) {
+			item.DateModified = v.UpdatedAt.Format(time.RFC3339)
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return json.Marshal(feed)
+}
+
+// get feed bytes (cached)
+func (s *server) getFeed(format, tagName string) ([]byte, error) {
+	key := format + ":" + tagName
+	generation := s.cacheFeed.Generation()
+	if val, ok := s.cacheFeed.Get(key); ok {
+		return val.([]byte), nil
+	}
+	entries, err := s.getFeedEntries(tagName)
+	if err != nil {
+		return nil, err
+	}
+	if tagName != "" && len(entries) == 0 {
+		return nil, errNotFound
+	}
+	var b []byte
+	switch format {
+	case FeedAtom:
+		b, err = s.buildAtom(tagName, entries)
+	case FeedJSON:
+		b, err = s.buildJSONFeed(tagName, entries)
+	default:
+		b, err = s.buildRSS(tagName, entries)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.cacheFeed.Set(key, b, generation)
+	return b, nil
+}
+
+func (s *server) feedResponse(c echo.Context, format, contentType string) error {
+	tagName := ""
+	if param := tagParam(c); param != "" {
+		var ok bool
+		if tagName, ok = s.tagNameByParam(param); !ok {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+	}
+	b, err := s.getFeed(format, tagName)
+	if err == errNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+	return c.Blob(http.StatusOK, contentType, b)
+}
+
+// rss action (feed.xml, tag/:tagName/feed.xml)
+func (s *server) rssAction(c echo.Context) error {
+	return s.feedResponse(c, FeedRSS, ContentTypeRSS)
+}
+
+// atom action (atom.xml, tag/:tagName/atom.xml)
+func (s *server) atomAction(c echo.Context) error {
+	return s.feedResponse(c, FeedAtom, ContentTypeAtom)
+}
+
+// json feed action (feed.json, tag/:tagName/feed.json)
+func (s *server) jsonFeedAction(c echo.Context) error {
+	return s.feedResponse(c, FeedJSON, ContentTypeJSONFeed)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// timeout of the database ping in readyz
+const readinessPingTimeout = 2 * time.Second
+
+var (
+	errTemplatesNotLoaded = errors.New("templates are not loaded")
+	// dbのerrorには接続先等が含まれるのでresponseにはこちらを返す (詳細はlogに出す)
+	errDatabaseUnavailable = errors.New("database is unavailable")
+)
+
+// HealthCheck - result of a readiness check
+type HealthCheck struct {
+	Status    string  `json:"status"`
+	Error     string  `json:"error,omitempty"`
+	LatencyMs float64 `json:"latencyMs,omitempty"`
+}
+
+func healthCheckResult(err error) HealthCheck {
+	if err != nil {
+		return HealthCheck{Status: "error", Error: err.Error()}
+	}
+	return HealthCheck{Status: "ok"}
+}
+
+// mark as shutting down (readyz returns 503 after this)
+func (s *server) beginShutdown() {
+	atomic.StoreInt32(&s.shuttingDown, 1)
+}
+
+func (s *server) isShuttingDown() bool {
+	return atomic.LoadInt32(&s.shuttingDown) == 1
+}
+
+// healthz action (process is alive)
+func (s *server) healthzAction(c echo.Context) error {
+	return c.JSON(http.StatusOK, map[string]interface{}{
+		"status":        "ok",
+		"uptimeSeconds": int64(time.Since(s.startedAt).Seconds()),
+	})
+}
+
+// readyz action (database, templates, settings)
+// 1つでも失敗した場合とgraceful shutdown中は503
+func (s *server) readyzAction(c echo.Context) error {
+	checks := map[string]HealthCheck{
+		"database":  s.checkDatabase(c),
+		"templates": healthCheckResult(checkTemplates(c.Echo())),
+		"settings":  healthCheckResult(validateSettings(settings)),
+	}
+	ready := !s.isShuttingDown()
+	for _, v := range checks {
+		if v.Status != "ok" {
+			ready = false
+		}
+	}
+	status, code := "ok", http.StatusOK
+	if !ready {
+		status, code = "unavailable", http.StatusServiceUnavailable
+	}
+	return c.JSON(code, map[string]interface{}{
+		"status":       status,
+		"shuttingDown": s.isShuttingDown(),
+		"checks":       checks,
+	})
+}
+
+// ping the database with timeout
+func (s *server) checkDatabase(c echo.Context) HealthCheck {
+	pinger, ok := s.entries.(Pinger)
+	if !ok {
+		return HealthCheck{Status: "ok"}
+	}
+	ctx, cancel := context.WithTimeout(c.Request().Context(), readinessPingTimeout)
+	defer cancel()
+	start := time.Now()
+	err := pinger.Ping(ctx)
+	if err != nil {
+		requestLogger(c).Warn("database ping error", "error", err)
+		err = errDatabaseUnavailable
+	}
+	result := healthCheckResult(err)
+	result.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	return result
+}
+
+// templates are parsed and error page exists
+func checkTemplates(e *echo.Echo) error {
+	renderer, ok := e.Renderer.(*templateRenderer)
+	if !ok || renderer.templates == nil {
+		return errTemplatesNotLoaded
+	}
+	if !renderer.hasTemplate("error.html") {
+		return errTemplatesNotLoaded
+	}
+	return nil
+}
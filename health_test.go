@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// failingPingRepository - Ping fails with an error which has connection details
+type failingPingRepository struct {
+	*memoryRepository
+}
+
+func (r failingPingRepository) Ping(ctx context.Context) error {
+	return errors.New("dial tcp 10.0.0.5:27017: connection refused")
+}
+
+func TestReadyz(t *testing.T) {
+	tests := []struct {
+		name         string
+		failingPing  bool
+		shuttingDown bool
+		status       int
+	}{
+		{"ready", false, false, http.StatusOK},
+		{"database error", true, false, http.StatusServiceUnavailable},
+		{"shutting down", false, true, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository(nil, nil)
+			s, e := newTestServer(t, repo)
+			if tt.failingPing {
+				s.entries = failingPingRepository{repo}
+			}
+			if tt.shuttingDown {
+				s.beginShutdown()
+			}
+			rec := newTestClient(e).get("/readyz")
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+			// dbのerrorの詳細は返さない
+			if body := rec.Body.String(); strings.Contains(body, "10.0.0.5") {
+				t.Errorf("body has the database error: %s", body)
+			}
+		})
+	}
+}
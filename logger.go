@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// log levels
+const (
+	LogLevelDebug = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+// Logger - leveled logger which writes a json object per line
+type Logger struct {
+	out   io.Writer
+	level int
+	// key, value, key, value...
+	fields []interface{}
+}
+
+// loggers (initializeLoggingまではstderrに出力する)
+var (
+	appLog    = newLogger(os.Stderr, LogLevelInfo)
+	accessLog = newLogger(os.Stderr, LogLevelInfo)
+)
+
+func newLogger(out io.Writer, level int) *Logger {
+	return &Logger{out: out, level: level}
+}
+
+// level name -> level (unknown = info)
+func parseLogLevel(name string) int {
+	for i, v := range logLevelNames {
+		if strings.EqualFold(v, name) {
+			return i
+		}
+	}
+	return LogLevelInfo
+}
+
+// With returns a logger which adds the key-value pairs to every line
+func (l *Logger) With(keyValues ...interface{}) *Logger {
+	fields := append(append([]interface{}(nil), l.fields...), keyValues...)
+	return &Logger{out: l.out, level: l.level, fields: fields}
+}
+
+func (l *Logger) Debug(msg string, keyValues ...interface{}) {
+	l.log(LogLevelDebug, msg, keyValues)
+}
+
+func (l *Logger) Info(msg string, keyValues ...interface{}) {
+	l.log(LogLevelInfo, msg, keyValues)
+}
+
+func (l *Logger) Warn(msg string, keyValues ...interface{}) {
+	l.log(LogLevelWarn, msg, keyValues)
+}
+
+func (l *Logger) Error(msg string, keyValues ...interface{}) {
+	l.log(LogLevelError, msg, keyValues)
+}
+
+// {"time": ..., "level": ..., "msg": ..., key: value...}
+func (l *Logger) log(level int, msg string, keyValues []interface{}) {
+	if level < l.level {
+		return
+	}
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	writeLogValue(&b, time.Now().Format(time.RFC3339Nano))
+	b.WriteString(`,"level":`)
+	writeLogValue(&b, logLevelNames[level])
+	b.WriteString(`,"msg":`)
+	writeLogValue(&b, msg)
+	fields := append(append([]interface{}(nil), l.fields...), keyValues...)
+	for i := 0; i < len(fields); i += 2 {
+		b.WriteByte(',')
+		writeLogValue(&b, fmt.Sprint(fields[i]))
+		b.WriteByte(':')
+		if i+1 < len(fields) {
+			writeLogValue(&b, fields[i+1])
+		} else {
+			b.WriteString("null")
+		}
+	}
+	b.WriteString("}\n")
+	// 1行を1回のWriteで書き込む (rotatingWriterで行が分割されないように)
+	l.out.Write(b.Bytes())
+}
+
+func writeLogValue(b *bytes.Buffer, value interface{}) {
+	switch v := value.(type) {
+	case error:
+		value = v.Error()
+	case time.Duration:
+		value = v.String()
+	case fmt.Stringer:
+		value = v.String()
+	}
+	j, err := json.Marshal(value)
+	if err != nil {
+		j, _ = json.Marshal(fmt.Sprint(value))
+	}
+	b.Write(j)
+}
+
+// logger with request id of the request
+func requestLogger(c echo.Context) *Logger {
+	return appLog.With("request_id", c.Response().Header().Get(echo.HeaderXRequestID))
+}
+
+// access log middleware (status is written after HTTPErrorHandler)
+func accessLogMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+		req, res := c.Request(), c.Response()
+		accessLog.Info("access",
+			"request_id", res.Header().Get(echo.HeaderXRequestID),
+			"remote_ip", c.RealIP(),
+			"method", req.Method,
+			"uri", req.RequestURI,
+			"route", c.Path(),
+			"status", res.Status,
+			"bytes", res.Size,
+			"latency_ms", float64(time.Since(start).Microseconds())/1000,
+			"referer", req.Referer(),
+			"user_agent", req.UserAgent(),
+		)
+		return nil
+	}
+}
+
+// std log -> appLog (library等のlog.Printもjsonにする)
+type stdLogWriter struct {
+	logger *Logger
+}
+
+func (w stdLogWriter) Write(p []byte) (int, error) {
+	w.logger.Info(strings.TrimRight(string(p), "\n"))
+	return len(p), nil
+}
+
+// open log/app.log, log/access.log with rotation ([log] section)
+// 開発環境ではstdoutにも出力する
+func initializeLogging() ([]io.Closer, error) {
+	if err := os.MkdirAll(settings.LogDir, 0755); err != nil {
+		return nil, err
+	}
+	var closers []io.Closer
+	var writers []io.Writer
+	for _, name := range []string{"app.log", "access.log"} {
+		w, err := newRotatingWriter(filepath.Join(settings.LogDir, name), int64(settings.LogMaxSize)*1024*1024, settings.LogRotateInterval, settings.LogMaxBackups)
+		if err != nil {
+			return closers, err
+		}
+		closers = append(closers, w)
+		if isDevelopment() {
+			writers = append(writers, io.MultiWriter(w, os.Stdout))
+		} else {
+			writers = append(writers, w)
+		}
+	}
+	level := parseLogLevel(settings.LogLevel)
+	appLog = newLogger(writers[0], level)
+	accessLog = newLogger(writers[1], level)
+	log.SetFlags(0)
+	log.SetOutput(stdLogWriter{logger: appLog})
+	return closers, nil
+}
+
+// rotatingWriter - file writer which rotates by size and interval
+// name.log -> name-20060102-150405.log, MaxBackupsを超えた古いものは削除する
+type rotatingWriter struct {
+	mu   sync.Mutex
+	path string
+	// bytes (0 = no limit)
+	maxSize int64
+	// 0 = no time based rotation
+	interval time.Duration
+	// 0 = keep all
+	maxBackups int
+	file       *os.File
+	size       int64
+	openedAt   time.Time
+	// rotateに失敗した場合は書き込み毎に再試行しないように待つ
+	retryRotateAt time.Time
+}
+
+// wait before retrying a failed rotation
+const logRotateRetryInterval = time.Minute
+
+func newRotatingWriter(path string, maxSize int64, interval time.Duration, maxBackups int) (*rotatingWriter, error) {
+	w := &rotatingWriter{path: path, maxSize: maxSize, interval: interval, maxBackups: maxBackups}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotatingWriter) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	w.file = file
+	w.size = info.Size()
+	// 既存のファイルは最後に書き込まれた時刻の期間に属するものとする
+	w.openedAt = time.Now()
+	if w.size > 0 {
+		w.openedAt = info.ModTime()
+	}
+	return nil
+}
+
+// interval boundary (UTC) was crossed since the file was opened
+func (w *rotatingWriter) isExpired() bool {
+	return w.interval > 0 && !time.Now().Truncate(w.interval).Equal(w.openedAt.Truncate(w.interval))
+}
+
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.size > 0 && ((w.maxSize > 0 && w.size+int64(len(p)) > w.maxSize) || w.isExpired()) && !time.Now().Before(w.retryRotateAt) {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// rename the file to the backup name and open a new file
+// rename/openに失敗した場合は元のfileに追記を続け、失敗をstderrに出す (logが止まらないように)
+func (w *rotatingWriter) rotate() error {
+	w.file.Close()
+	ext := filepath.Ext(w.path)
+	base := strings.TrimSuffix(w.path, ext)
+	backup := base + "-" + time.Now().Format("20060102-150405") + ext
+	for i := 1; fileExists(backup); i++ {
+		backup = fmt.Sprintf("%s-%s.%d%s", base, time.Now().Format("20060102-150405"), i, ext)
+	}
+	err := os.Rename(w.path, backup)
+	if err == nil {
+		if err = w.open(); err == nil {
+			w.removeOldBackups(base, ext)
+			return nil
+		}
+	}
+	fmt.Fprintf(os.Stderr, "log rotation of %s failed: %v\n", w.path, err)
+	w.retryRotateAt = time.Now().Add(logRotateRetryInterval)
+	return w.open()
+}
+
+// order of a backup name: time and sequence (name-20060102-150405.log = 0, name-20060102-150405.N.log = N)
+func logBackupOrder(name, base, ext string) (string, int) {
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, base+"-"), ext)
+	if i := strings.Index(stamp, "."); i >= 0 {
+		n, _ := strconv.Atoi(stamp[i+1:])
+		return stamp[:i], n
+	}
+	return stamp, 0
+}
+
+func (w *rotatingWriter) removeOldBackups(base, ext string) {
+	if w.maxBackups <= 0 {
+		return
+	}
+	backups, err := filepath.Glob(base + "-*" + ext)
+	if err != nil || len(backups) <= w.maxBackups {
+		return
+	}
+	// 日時, 同じ秒の場合は連番(数値)の順 = 古い順
+	sort.Slice(backups, func(i, j int) bool {
+		ti, ni := logBackupOrder(backups[i], base, ext)
+		tj, nj := logBackupOrder(backups[j], base, ext)
+		if ti != tj {
+			return ti < tj
+		}
+		return ni < nj
+	})
+	for _, v := range backups[:len(backups)-w.maxBackups] {
+		os.Remove(v)
+	}
+}
+
+func (w *rotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
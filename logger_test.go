@@ -0,0 +1,106 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRotatingWriterSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := newRotatingWriter(path, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, v := range []string{"first\n", "second\n"} {
+		if _, err := w.Write([]byte(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, _ := filepath.Glob(strings.TrimSuffix(path, ".log") + "-*.log")
+	if len(backups) != 1 || readFile(t, backups[0]) != "first\n" {
+		t.Fatalf("backups = %v", backups)
+	}
+	if got := readFile(t, path); got != "second\n" {
+		t.Errorf("current file = %q", got)
+	}
+}
+
+func TestRotatingWriterRotateFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	w, err := newRotatingWriter(path, 10, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	w.Write([]byte("first\n"))
+	// renameできない状態にする
+	os.Remove(path)
+	if _, err := w.Write([]byte("second\n")); err != nil {
+		t.Fatalf("write after failed rotation: %v", err)
+	}
+	if got := readFile(t, path); got != "second\n" {
+		t.Errorf("file after failed rotation = %q", got)
+	}
+	if w.retryRotateAt.IsZero() {
+		t.Error("rotation is retried on every write")
+	}
+	// 再試行までは同じfileに追記する
+	w.Write([]byte("third\n"))
+	if got := readFile(t, path); got != "second\nthird\n" {
+		t.Errorf("file before retry = %q", got)
+	}
+}
+
+func TestRemoveOldBackups(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "app")
+	// 古い順
+	names := []string{
+		"app-20210101-000000.log",
+		"app-20210101-000000.1.log",
+		"app-20210101-000000.2.log",
+		"app-20210101-000000.10.log",
+		"app-20210101-000001.log",
+	}
+	tests := []struct {
+		maxBackups int
+		want       []string
+	}{
+		{0, names},
+		{2, names[3:]},
+		{4, names[1:]},
+	}
+	for _, tt := range tests {
+		for _, v := range names {
+			if err := os.WriteFile(filepath.Join(dir, v), nil, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		w := &rotatingWriter{maxBackups: tt.maxBackups}
+		w.removeOldBackups(base, ".log")
+		matches, _ := filepath.Glob(base + "-*.log")
+		var got []string
+		for _, v := range matches {
+			got = append(got, filepath.Base(v))
+		}
+		want := append([]string(nil), tt.want...)
+		sort.Strings(got)
+		sort.Strings(want)
+		if !equalStrings(got, want) {
+			t.Errorf("maxBackups %d: kept %v, want %v", tt.maxBackups, got, want)
+		}
+	}
+}
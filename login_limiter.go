@@ -0,0 +1,336 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// login throttling
+// ipとusernameそれぞれの失敗回数でbackoff/lockoutする. passwordの確認前に失敗として数え、成功した場合はusernameの回数を戻す
+// (同時に大量に送られた場合もbackoffをすり抜けないようにするため)
+const (
+	// backoff starts after this number of failures
+	loginFreeAttempts = 3
+	// username is truncated in keys and records
+	maxLoginUserNameLength = 64
+	// expired throttles are removed when the in-process store has this many keys
+	loginThrottlePruneSize = 1000
+)
+
+// reason of LoginFailure
+const (
+	LoginFailureInvalid   = "invalid"
+	LoginFailureThrottled = "throttled"
+	LoginFailureLocked    = "locked"
+	// wrong TOTP/recovery code after the password
+	LoginFailureInvalidCode = "invalid_code"
+)
+
+// LoginThrottle - failure counter of an ip (ip:...) or a username (user:...)
+type LoginThrottle struct {
+	Key         string    `json:"key" bson:"_id"`
+	Failures    int       `json:"failures" bson:"failures"`
+	LastFailure time.Time `json:"lastFailure" bson:"lastFailure"`
+	// zero if not locked
+	LockedUntil time.Time `json:"lockedUntil" bson:"lockedUntil"`
+	// the counter is forgotten after this
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt"`
+}
+
+// LoginFailure - record of a failed login
+type LoginFailure struct {
+	Time      time.Time `json:"time" bson:"time"`
+	UserName  string    `json:"userName" bson:"userName"`
+	RemoteIP  string    `json:"remoteIp" bson:"remoteIp"`
+	UserAgent string    `json:"userAgent" bson:"userAgent"`
+	Reason    string    `json:"reason" bson:"reason"`
+}
+
+// LoginAttemptStore - storage of login throttles and failure records
+// 標準はprocess内 (再起動で消える). 複数processで共有する場合はmongodb等の実装に差し替える
+type LoginAttemptStore interface {
+	// throttle which is not expired (errNotFound if none)
+	FindLoginThrottle(key string, now time.Time) (LoginThrottle, error)
+	// throttles which are not expired ordered by lastFailure desc
+	FindLoginThrottles(now time.Time) ([]LoginThrottle, error)
+	// insert or replace the throttle which has same key
+	SaveLoginThrottle(throttle LoginThrottle) error
+	DeleteLoginThrottle(key string) error
+	InsertLoginFailure(failure LoginFailure) error
+	// failures ordered by time desc
+	FindLoginFailures(limit int) ([]LoginFailure, error)
+}
+
+// loginLimiter - backoff and lockout of backend logins ([login] settings)
+type loginLimiter struct {
+	// begin()の確認と加算を同時に行う
+	mu               sync.Mutex
+	store            LoginAttemptStore
+	backoffBase      time.Duration
+	backoffMax       time.Duration
+	lockoutThreshold int
+	lockoutDuration  time.Duration
+}
+
+func newLoginLimiter(s Settings, store LoginAttemptStore) *loginLimiter {
+	return &loginLimiter{
+		store:            store,
+		backoffBase:      s.LoginBackoffBase,
+		backoffMax:       s.LoginBackoffMax,
+		lockoutThreshold: s.LoginLockoutThreshold,
+		lockoutDuration:  s.LoginLockoutDuration,
+	}
+}
+
+// keys of the throttles (usernameは大文字小文字を区別しない)
+func loginThrottleKeys(remoteIP, userName string) []string {
+	return []string{"ip:" + remoteIP, loginUserThrottleKey(userName)}
+}
+
+func loginUserThrottleKey(userName string) string {
+	return "user:" + strings.ToLower(truncateLoginUserName(userName))
+}
+
+func truncateLoginUserName(userName string) string {
+	userName = strings.TrimSpace(userName)
+	if len(userName) > maxLoginUserNameLength {
+		return userName[:maxLoginUserNameLength]
+	}
+	return userName
+}
+
+// wait after the failures (loginFreeAttempts回目までは0, 以降backoffBaseから倍々でbackoffMaxまで)
+func (l *loginLimiter) backoff(failures int) time.Duration {
+	if failures < loginFreeAttempts {
+		return 0
+	}
+	d := l.backoffBase
+	for i := loginFreeAttempts; i < failures && d < l.backoffMax; i++ {
+		d *= 2
+	}
+	if d > l.backoffMax {
+		return l.backoffMax
+	}
+	return d
+}
+
+// time until the next attempt is allowed (zero if allowed now)
+func (l *loginLimiter) retryAt(t LoginThrottle) time.Time {
+	retryAt := t.LastFailure.Add(l.backoff(t.Failures))
+	if t.LockedUntil.After(retryAt) {
+		return t.LockedUntil
+	}
+	return retryAt
+}
+
+// begin an attempt: returns reason and time until retry if throttled, otherwise counts the attempt as a failure
+func (l *loginLimiter) begin(remoteIP, userName string, now time.Time) (string, time.Time, error) {
+	return l.beginKeys(loginThrottleKeys(remoteIP, userName), now)
+}
+
+// begin an attempt of the loggedin user (TOTPの無効化等). usernameの回数のみ使う
+func (l *loginLimiter) beginUser(userName string, now time.Time) (string, time.Time, error) {
+	return l.beginKeys([]string{loginUserThrottleKey(userName)}, now)
+}
+
+func (l *loginLimiter) beginKeys(keys []string, now time.Time) (string, time.Time, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var throttles []LoginThrottle
+	for _, key := range keys {
+		t, err := l.store.FindLoginThrottle(key, now)
+		if err == errNotFound {
+			t = LoginThrottle{Key: key}
+		} else if err != nil {
+			return "", time.Time{}, err
+		}
+		if now.Before(t.LockedUntil) {
+			return LoginFailureLocked, t.LockedUntil, nil
+		}
+		if retryAt := l.retryAt(t); now.Before(retryAt) {
+			return LoginFailureThrottled, retryAt, nil
+		}
+		throttles = append(throttles, t)
+	}
+	for _, t := range throttles {
+		t.Failures++
+		t.LastFailure = now
+		if t.Failures >= l.lockoutThreshold {
+			t.LockedUntil = now.Add(l.lockoutDuration)
+		}
+		t.ExpiresAt = now.Add(l.lockoutDuration)
+		if retryAt := l.retryAt(t); retryAt.After(t.ExpiresAt) {
+			t.ExpiresAt = retryAt
+		}
+		if err := l.store.SaveLoginThrottle(t); err != nil {
+			return "", time.Time{}, err
+		}
+	}
+	return "", time.Time{}, nil
+}
+
+// the attempt succeeded: reset the counter of the username and cancel the count of this attempt for the ip
+// ipの以前の失敗回数は残す (自分のaccountでのログインを挟んでipのbackoffを解除できないようにする. 期限で消える)
+func (l *loginLimiter) succeeded(remoteIP, userName string, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.uncount("ip:"+remoteIP, now); err != nil {
+		return err
+	}
+	return l.deleteThrottle(loginUserThrottleKey(userName))
+}
+
+// the attempt of beginUser() succeeded: reset the counter of the username
+func (l *loginLimiter) userSucceeded(userName string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.deleteThrottle(loginUserThrottleKey(userName))
+}
+
+// the password was correct but the second factor is pending: cancel the count of the attempt
+// TOTPの試行回数はリセットしない (passwordを知っている場合にcodeを試し続けられないようにする)
+func (l *loginLimiter) refund(remoteIP, userName string, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range loginThrottleKeys(remoteIP, userName) {
+		if err := l.uncount(key, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cancel one failure counted by begin() (0になった場合は削除する)
+func (l *loginLimiter) uncount(key string, now time.Time) error {
+	t, err := l.store.FindLoginThrottle(key, now)
+	if err == errNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if t.Failures <= 1 && t.LockedUntil.IsZero() {
+		return l.deleteThrottle(key)
+	}
+	if t.Failures > 0 {
+		t.Failures--
+	}
+	return l.store.SaveLoginThrottle(t)
+}
+
+func (l *loginLimiter) deleteThrottle(key string) error {
+	if err := l.store.DeleteLoginThrottle(key); err != nil && err != errNotFound {
+		return err
+	}
+	return nil
+}
+
+// record a failed attempt (begin()で既に数えているのでcounterは変えない)
+func (l *loginLimiter) failed(remoteIP, userName, userAgent, reason string, now time.Time) error {
+	return l.store.InsertLoginFailure(LoginFailure{
+		Time:      now,
+		UserName:  truncateLoginUserName(userName),
+		RemoteIP:  remoteIP,
+		UserAgent: userAgent,
+		Reason:    reason,
+	})
+}
+
+// unlock an ip or a username (key = ip:... / user:...)
+func (l *loginLimiter) unlock(key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.store.DeleteLoginThrottle(key)
+}
+
+// memoryLoginAttemptStore - in-process LoginAttemptStore
+type memoryLoginAttemptStore struct {
+	mu        sync.Mutex
+	throttles map[string]LoginThrottle
+	// newest last, up to historySize
+	failures    []LoginFailure
+	historySize int
+}
+
+func newMemoryLoginAttemptStore(historySize int) *memoryLoginAttemptStore {
+	return &memoryLoginAttemptStore{throttles: make(map[string]LoginThrottle), historySize: historySize}
+}
+
+// FindLoginThrottle returns a throttle which is not expired by key
+func (st *memoryLoginAttemptStore) FindLoginThrottle(key string, now time.Time) (LoginThrottle, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	t, ok := st.throttles[key]
+	if !ok || !t.ExpiresAt.After(now) {
+		return LoginThrottle{}, errNotFound
+	}
+	return t, nil
+}
+
+// FindLoginThrottles returns throttles which are not expired ordered by lastFailure desc
+func (st *memoryLoginAttemptStore) FindLoginThrottles(now time.Time) ([]LoginThrottle, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	results := []LoginThrottle{}
+	for _, v := range st.throttles {
+		if v.ExpiresAt.After(now) {
+			results = append(results, v)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].LastFailure.After(results[j].LastFailure)
+	})
+	return results, nil
+}
+
+// SaveLoginThrottle inserts or replaces the throttle
+// ランダムなusername等でkeyが増え続けないように、一定数を超えたら期限切れを削除する
+func (st *memoryLoginAttemptStore) SaveLoginThrottle(throttle LoginThrottle) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if _, ok := st.throttles[throttle.Key]; !ok && len(st.throttles) >= loginThrottlePruneSize {
+		now := time.Now()
+		for k, v := range st.throttles {
+			if !v.ExpiresAt.After(now) {
+				delete(st.throttles, k)
+			}
+		}
+	}
+	st.throttles[throttle.Key] = throttle
+	return nil
+}
+
+// DeleteLoginThrottle deletes a throttle by key
+func (st *memoryLoginAttemptStore) DeleteLoginThrottle(key string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if _, ok := st.throttles[key]; !ok {
+		return errNotFound
+	}
+	delete(st.throttles, key)
+	return nil
+}
+
+// InsertLoginFailure appends a failure record (古いものから削除する)
+func (st *memoryLoginAttemptStore) InsertLoginFailure(failure LoginFailure) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.failures = append(st.failures, failure)
+	if n := len(st.failures) - st.historySize; n > 0 {
+		st.failures = append([]LoginFailure(nil), st.failures[n:]...)
+	}
+	return nil
+}
+
+// FindLoginFailures returns failure records ordered by time desc
+func (st *memoryLoginAttemptStore) FindLoginFailures(limit int) ([]LoginFailure, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	results := []LoginFailure{}
+	for i := len(st.failures) - 1; i >= 0 && (limit <= 0 || len(results) < limit); i-- {
+		results = append(results, st.failures[i])
+	}
+	return results, nil
+}
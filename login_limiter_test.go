@@ -0,0 +1,164 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestLoginLimiter() *loginLimiter {
+	return &loginLimiter{
+		store:            newMemoryLoginAttemptStore(10),
+		backoffBase:      time.Second,
+		backoffMax:       10 * time.Second,
+		lockoutThreshold: 10,
+		lockoutDuration:  time.Hour,
+	}
+}
+
+func TestLoginLimiterBackoff(t *testing.T) {
+	l := newTestLoginLimiter()
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{loginFreeAttempts - 1, 0},
+		{loginFreeAttempts, time.Second},
+		{loginFreeAttempts + 1, 2 * time.Second},
+		{loginFreeAttempts + 3, 8 * time.Second},
+		// backoffMaxまで
+		{loginFreeAttempts + 4, 10 * time.Second},
+		{100, 10 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := l.backoff(tt.failures); got != tt.want {
+			t.Errorf("backoff(%d) = %s, want %s", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestLoginLimiterBegin(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		// attempts before the checked one (seconds after now)
+		attempts []int
+		remoteIP string
+		userName string
+		at       int
+		want     string
+	}{
+		{"free attempts", []int{0, 0}, "1.2.3.4", "admin", 0, ""},
+		{"backoff", []int{0, 0, 0}, "1.2.3.4", "admin", 0, LoginFailureThrottled},
+		{"after backoff", []int{0, 0, 0}, "1.2.3.4", "admin", 1, ""},
+		// ipとusernameのどちらかがbackoff中なら止める
+		{"same ip other user", []int{0, 0, 0}, "1.2.3.4", "guest", 0, LoginFailureThrottled},
+		{"same user other ip", []int{0, 0, 0}, "5.6.7.8", "admin", 0, LoginFailureThrottled},
+		{"username is case insensitive", []int{0, 0, 0}, "5.6.7.8", "ADMIN", 0, LoginFailureThrottled},
+		{"other ip and user", []int{0, 0, 0}, "5.6.7.8", "guest", 0, ""},
+		{"lockout", []int{0, 1, 2, 4, 8, 16, 32, 42, 52, 62}, "1.2.3.4", "admin", 1000, LoginFailureLocked},
+		{"after lockout", []int{0, 1, 2, 4, 8, 16, 32, 42, 52, 62}, "1.2.3.4", "admin", 62 + 3600, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLoginLimiter()
+			for _, v := range tt.attempts {
+				reason, _, err := l.begin("1.2.3.4", "admin", now.Add(time.Duration(v)*time.Second))
+				if err != nil || reason != "" {
+					t.Fatalf("attempt at %ds: %q, %v", v, reason, err)
+				}
+			}
+			reason, _, err := l.begin(tt.remoteIP, tt.userName, now.Add(time.Duration(tt.at)*time.Second))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if reason != tt.want {
+				t.Errorf("reason = %q, want %q", reason, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoginLimiterRefundAndSucceeded(t *testing.T) {
+	now := time.Now()
+	failures := func(l *loginLimiter, key string) int {
+		throttle, err := l.store.FindLoginThrottle(key, now)
+		if err == errNotFound {
+			return 0
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return throttle.Failures
+	}
+	tests := []struct {
+		name   string
+		finish func(l *loginLimiter) error
+		ip     int
+		user   int
+	}{
+		{"failed", func(l *loginLimiter) error { return nil }, 2, 2},
+		// passwordは正しくTOTPが未確認
+		{"refund", func(l *loginLimiter) error { return l.refund("1.2.3.4", "admin", now) }, 1, 1},
+		// このattemptの分だけ戻し、ipの以前の失敗回数は残る
+		{"succeeded", func(l *loginLimiter) error { return l.succeeded("1.2.3.4", "Admin", now) }, 1, 0},
+		{"user succeeded", func(l *loginLimiter) error { return l.userSucceeded("admin") }, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLoginLimiter()
+			for i := 0; i < 2; i++ {
+				if _, _, err := l.begin("1.2.3.4", "admin", now); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := tt.finish(l); err != nil {
+				t.Fatal(err)
+			}
+			if ip, user := failures(l, "ip:1.2.3.4"), failures(l, "user:admin"); ip != tt.ip || user != tt.user {
+				t.Errorf("failures = ip %d, user %d, want ip %d, user %d", ip, user, tt.ip, tt.user)
+			}
+		})
+	}
+}
+
+// 成功したログインは何回続いてもbackoffしない
+func TestLoginLimiterSuccessfulLogins(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name  string
+		login func(t *testing.T, l *loginLimiter, now time.Time) error
+	}{
+		{"password", func(t *testing.T, l *loginLimiter, now time.Time) error {
+			return l.succeeded("1.2.3.4", "admin", now)
+		}},
+		// password -> refund -> TOTP
+		{"totp", func(t *testing.T, l *loginLimiter, now time.Time) error {
+			if err := l.refund("1.2.3.4", "admin", now); err != nil {
+				return err
+			}
+			reason, _, err := l.begin("1.2.3.4", "admin", now)
+			if err != nil || reason != "" {
+				t.Fatalf("totp step: %q, %v", reason, err)
+			}
+			return l.succeeded("1.2.3.4", "admin", now)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newTestLoginLimiter()
+			for i := 0; i < l.lockoutThreshold*2; i++ {
+				reason, _, err := l.begin("1.2.3.4", "admin", now)
+				if err != nil || reason != "" {
+					t.Fatalf("login %d: %q, %v", i+1, reason, err)
+				}
+				if err := tt.login(t, l, now); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if throttles, _ := l.store.FindLoginThrottles(now); len(throttles) != 0 {
+				t.Errorf("throttles = %v", throttles)
+			}
+		})
+	}
+}
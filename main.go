@@ -2,67 +2,115 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/gorilla/sessions"
-	"github.com/labstack/echo-contrib/session"
 	"github.com/labstack/echo/v4"
 )
 
-func init() {
-	initializeData()
-}
-
 func main() {
-	defer closeConnection()
-	e := echo.New()
-	// <input type="hidden" name="csrf" value="dfasjkjhl(random文字列)" ～ではなく
-	// Phalconのように <input type="hidden" name="jfuioashfg;lsa(random文字列)" value="dfasjkjhl(random文字列)"としたいので非採用
-	// random文字列の生成についてはechoに準拠(auth.go参照)
-	// ---
-	// echo v4.2でSameSite設定がきた https://github.com/labstack/echo/pull/1524/files/8b2c77b1079c17fc9d7b1b420b2c3102c4069d6f
-	/*e.Use(middleware.CSRFWithConfig(middleware.CSRFConfig{
-		TokenLookup:    "form:csrftoken",
-		CookiePath:     settings.RootPath + settings.BackendURI,
-		CookieHTTPOnly: true,
-		CookieMaxAge:   0,
-		CookieName:     "_dct",
-		CookieSecure:   !isDevelopment(), // 開発環境ではfalse
-		CookieSameSite: http.SameSiteStrictMode,
-	}))*/
-	e.Use(session.Middleware(sessions.NewCookieStore([]byte("secret"))))
-	e.Static(settings.RootPath+"files", "./files")
-	e.File("/favicon.ico", "files/images/favicon.ico")
-	e.Renderer = getTemplateRenderer()
-	e.GET(settings.RootPath, indexAction)
-	e.GET(settings.RootPath+":entry_code", entryAction)
-	e.GET(settings.RootPath+"page/:num", pageAction)
-	e.GET(settings.RootPath+"tag/:tagName", tagAction)
-	e.GET(settings.RootPath+"error/:code", errorAction)
-	e.GET(settings.RootPath+settings.BackendURI, backendLoginAction)
-	e.POST(settings.RootPath+settings.BackendURI, authenticationAction)
-	e.GET(settings.RootPath+settings.BackendURI+"manager/", managerAction)
-	e.GET(settings.RootPath+settings.BackendURI+"manager/api/:param", apiGetAction)
-	e.POST(settings.RootPath+settings.BackendURI+"manager/api/:param", apiPostAction)
-	e.HTTPErrorHandler = errorHandler
+	configPath := flag.String("config", SettingsFilePath, "settings file (empty = environment variables only)")
+	flag.Parse()
+	if err := initializeData(*configPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	logClosers, err := initializeLogging()
+	if err != nil {
+		panic("log open error: " + err.Error())
+	}
+	defer func() {
+		for _, v := range logClosers {
+			v.Close()
+		}
+	}()
+	repo, err := openRepository()
+	if err != nil {
+		appLog.Error("db connect error", "driver", settings.DBDriver, "error", err)
+		panic("db connect error")
+	}
+	defer repo.Close()
+	// query latency/errorを計測する
+	var serverRepo Repository = repo
+	if settings.MetricsEnabled {
+		serverRepo = newMetricsRepository(repo)
+	}
+	s := newServer(serverRepo, serverRepo, serverRepo, serverRepo)
+	// cookie or server-side session ([session] Store)
+	sessionStore, sessionRepo, err := newSessionStore(settings, serverRepo)
+	if err != nil {
+		appLog.Error("session store error", "store", settings.SessionStore, "error", err)
+		panic("session store error")
+	}
+	s.sessions = sessionRepo
+	// 文字列で保存されている日時をdateに変換
+	if migrator, ok := repo.(DateMigrator); ok {
+		if n, err := migrator.MigrateDates(); err != nil {
+			appLog.Error("date migration error", "error", err)
+		} else if n > 0 {
+			appLog.Info("migrated dates", "entries", n)
+		}
+	}
+	// init tag slice
+	s.getTagsAll()
+	// background jobs
+	bgCtx, stopBg := context.WithCancel(context.Background())
+	defer stopBg()
+	// purge caches on db changes
+	if watcher, ok := repo.(EntryWatcher); ok && settings.CacheWatch {
+		go func() {
+			if err := s.watchEntries(bgCtx, watcher); err != nil {
+				appLog.Warn("cache watcher stopped", "error", err)
+			}
+		}()
+	}
+	// purge caches when scheduled entries go live
+	go s.runPublishScheduler(bgCtx)
+	if sessionRepo != nil {
+		go runSessionCleanup(bgCtx, sessionRepo)
+	}
+	e := s.newRouter(sessionStore)
+	// metrics on a separate port (Portが空の場合はnewRouterで同じportに登録する)
+	var metricsServer *echo.Echo
+	if settings.MetricsEnabled && settings.MetricsPort != "" {
+		metricsServer = echo.New()
+		metricsServer.HideBanner = true
+		metricsServer.HidePort = true
+		metricsServer.GET("/metrics", s.metricsAction)
+		go func() {
+			appLog.Info("starting the metrics server", "port", settings.MetricsPort)
+			if err := metricsServer.Start(settings.MetricsPort); err != nil {
+				appLog.Info("shutting down the metrics server", "reason", err)
+			}
+		}()
+	}
 	// start server
 	go func() {
+		appLog.Info("starting the server", "port", settings.HttpdPort)
 		if err := e.Start(settings.HttpdPort); err != nil {
-			/*
-				TODO: Log全般の実装
-			*/
-			e.Logger.Info("shutting down the server")
+			appLog.Info("shutting down the server", "reason", err)
 		}
 	}()
 	// graceful shutdown
-	quit := make(chan os.Signal)
-	signal.Notify(quit, os.Interrupt)
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
+	// readyzを503にしてload balancerから外れるまで待つ
+	s.beginShutdown()
+	appLog.Info("shutting down", "delay", settings.ShutdownDelay)
+	time.Sleep(settings.ShutdownDelay)
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	if err := e.Shutdown(ctx); err != nil {
-		e.Logger.Fatal(err)
+		appLog.Error("shutdown error", "error", err)
+	}
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			appLog.Error("metrics server shutdown error", "error", err)
+		}
 	}
 }
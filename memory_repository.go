@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryRepository - Repository implementation kept in process memory (for tests and local runs)
+type memoryRepository struct {
+	mu        sync.RWMutex
+	entries   []MongoEntries
+	users     []MongoUsers
+	revisions []MongoRevisions
+	tags      []MongoTags
+	sessions  map[string]MongoSessions
+}
+
+// memorySeed - json file format for loadMemoryRepository
+type memorySeed struct {
+	Entries []MongoEntries `json:"entries"`
+	Users   []MongoUsers   `json:"users"`
+	Tags    []MongoTags    `json:"tags"`
+}
+
+func newMemoryRepository(entries []MongoEntries, users []MongoUsers) *memoryRepository {
+	r := &memoryRepository{
+		entries:  append([]MongoEntries(nil), entries...),
+		users:    append([]MongoUsers(nil), users...),
+		sessions: make(map[string]MongoSessions),
+	}
+	r.sortEntries()
+	return r
+}
+
+// publishDate desc (mongoの実装に合わせる)
+func (r *memoryRepository) sortEntries() {
+	sort.SliceStable(r.entries, func(i, j int) bool {
+		return r.entries[i].PublishDate.After(r.entries[j].PublishDate)
+	})
+}
+
+// load entries, users and tags from json file
+func loadMemoryRepository(path string) (*memoryRepository, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var seed memorySeed
+	if err := json.Unmarshal(b, &seed); err != nil {
+		return nil, err
+	}
+	r := newMemoryRepository(seed.Entries, seed.Users)
+	r.tags = seed.Tags
+	return r, nil
+}
+
+// Close does nothing
+func (r *memoryRepository) Close() error {
+	return nil
+}
+
+// Ping always succeeds
+func (r *memoryRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+// filter entries with copy
+func (r *memoryRepository) filter(match func(MongoEntries) bool) []MongoEntries {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var results []MongoEntries
+	for _, v := range r.entries {
+		if match(v) {
+			v.Tag = append([]string(nil), v.Tag...)
+			results = append(results, v)
+		}
+	}
+	return results
+}
+
+// FindPublished returns published entries ordered by publishDate desc
+func (r *memoryRepository) FindPublished(now time.Time, offset, limit int) ([]MongoEntries, error) {
+	return paginateEntries(r.filter(func(v MongoEntries) bool { return isPublishedAt(v, now) }), offset, limit), nil
+}
+
+// offset/limit of entries (limit 0 = no limit, 負のoffsetは結果なし)
+func paginateEntries(results []MongoEntries, offset, limit int) []MongoEntries {
+	if offset < 0 || offset >= len(results) {
+		return nil
+	}
+	results = results[offset:]
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results
+}
+
+// FindPublishedByCode returns a published entry by entryCode
+func (r *memoryRepository) FindPublishedByCode(entryCode string, now time.Time) (MongoEntries, error) {
+	results := r.filter(func(v MongoEntries) bool {
+		return isPublishedAt(v, now) && v.EntryCode == entryCode
+	})
+	if len(results) == 0 {
+		return MongoEntries{}, errNotFound
+	}
+	return results[0], nil
+}
+
+// FindPublishedByTag returns published entries which have the tag
+func (r *memoryRepository) FindPublishedByTag(tagName string, now time.Time, offset, limit int) ([]MongoEntries, error) {
+	results := r.filter(func(v MongoEntries) bool {
+		if !isPublishedAt(v, now) {
+			return false
+		}
+		for _, t := range v.Tag {
+			if t == tagName {
+				return true
+			}
+		}
+		return false
+	})
+	return paginateEntries(results, offset, limit), nil
+}
+
+// FindPublishedBetween returns published entries in from <= publishDate < to
+func (r *memoryRepository) FindPublishedBetween(from, to, now time.Time) ([]MongoEntries, error) {
+	return r.filter(func(v MongoEntries) bool {
+		return isPublishedAt(v, now) && !v.PublishDate.Before(from) && v.PublishDate.Before(to)
+	}), nil
+}
+
+// FindScheduled returns published entries whose publishDate is after the time
+func (r *memoryRepository) FindScheduled(after time.Time, limit int) ([]MongoEntries, error) {
+	results := r.filter(func(v MongoEntries) bool {
+		return v.IsPublished == IsPublished && v.PublishDate.After(after)
+	})
+	// publishDate asc
+	for i, j := 0, len(results)-1; i < j; i, j = i+1, j-1 {
+		results[i], results[j] = results[j], results[i]
+	}
+	if limit > 0 && limit < len(results) {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// isPublished and publishDate <= now
+func isPublishedAt(entry MongoEntries, now time.Time) bool {
+	return entry.IsPublished == IsPublished && !entry.PublishDate.After(now)
+}
+
+// FindAll returns all entries ordered by publishDate desc
+func (r *memoryRepository) FindAll() ([]MongoEntries, error) {
+	return r.filter(func(MongoEntries) bool { return true }), nil
+}
+
+// FindByID returns an entry by _id
+func (r *memoryRepository) FindByID(id primitive.ObjectID) (MongoEntries, error) {
+	results := r.filter(func(v MongoEntries) bool { return v.ID == id })
+	if len(results) == 0 {
+		return MongoEntries{}, errNotFound
+	}
+	return results[0], nil
+}
+
+// FindByCode returns an entry by entryCode
+func (r *memoryRepository) FindByCode(entryCode string) (MongoEntries, error) {
+	results := r.filter(func(v MongoEntries) bool { return v.EntryCode == entryCode })
+	if len(results) == 0 {
+		return MongoEntries{}, errNotFound
+	}
+	return results[0], nil
+}
+
+// NextEntryID returns max entryId + 1
+func (r *memoryRepository) NextEntryID() (int32, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var max int32
+	for _, v := range r.entries {
+		if v.EntryID > max {
+			max = v.EntryID
+		}
+	}
+	return max + 1, nil
+}
+
+// Insert inserts an entry
+func (r *memoryRepository) Insert(entry MongoEntries) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry.Tag = append([]string(nil), entry.Tag...)
+	r.entries = append(r.entries, entry)
+	r.sortEntries()
+	return nil
+}
+
+// Update replaces the entry which has same _id
+func (r *memoryRepository) Update(entry MongoEntries) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, v := range r.entries {
+		if v.ID == entry.ID {
+			entry.Tag = append([]string(nil), entry.Tag...)
+			r.entries[i] = entry
+			r.sortEntries()
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+// ReplaceTags replaces tags of all entries which have any of from and tag metadata
+func (r *memoryRepository) ReplaceTags(from []string, to string, updatedAt time.Time) ([]MongoEntries, int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var befores []MongoEntries
+	for i, v := range r.entries {
+		if !hasAnyTag(v.Tag, from) {
+			continue
+		}
+		befores = append(befores, v)
+		r.entries[i].Tag = replaceTagNames(v.Tag, from, to)
+		r.entries[i].UpdatedAt = updatedAt
+	}
+	saves, deletes := replaceTagMetaDocs(r.tags, from, to)
+	var tags []MongoTags
+	for _, v := range r.tags {
+		if !containsObjectID(deletes, v.ID) {
+			tags = append(tags, v)
+		}
+	}
+	for i, v := range tags {
+		for _, saved := range saves {
+			if v.ID == saved.ID {
+				tags[i] = saved
+			}
+		}
+	}
+	r.tags = tags
+	return befores, len(saves) + len(deletes), nil
+}
+
+func containsObjectID(ids []primitive.ObjectID, id primitive.ObjectID) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Delete deletes an entry by _id
+func (r *memoryRepository) Delete(id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, v := range r.entries {
+		if v.ID == id {
+			r.entries = append(r.entries[:i], r.entries[i+1:]...)
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+// FindUserByName returns a backend user by name
+func (r *memoryRepository) FindUserByName(name string) (MongoUsers, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, v := range r.users {
+		if v.Name == name {
+			return v, nil
+		}
+	}
+	return MongoUsers{}, errNotFound
+}
+
+// FindUserByID returns a backend user by userId
+func (r *memoryRepository) FindUserByID(userID int32) (MongoUsers, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, v := range r.users {
+		if v.UserID == userID {
+			return v, nil
+		}
+	}
+	return MongoUsers{}, errNotFound
+}
+
+// UpdateUser replaces the user which has same _id
+func (r *memoryRepository) UpdateUser(user MongoUsers) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, v := range r.users {
+		if v.ID == user.ID {
+			user.RecoveryCodes = append([]string(nil), user.RecoveryCodes...)
+			r.users[i] = user
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+// InsertRevision inserts a revision
+func (r *memoryRepository) InsertRevision(revision MongoRevisions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range r.revisions {
+		if v.EntryObjectID == revision.EntryObjectID && v.Revision == revision.Revision {
+			return errDuplicateRevision
+		}
+	}
+	revision.Entry.Tag = append([]string(nil), revision.Entry.Tag...)
+	r.revisions = append(r.revisions, revision)
+	return nil
+}
+
+// FindRevisions returns revisions of the entry ordered by revision desc
+func (r *memoryRepository) FindRevisions(entryObjectID primitive.ObjectID) ([]MongoRevisions, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var results []MongoRevisions
+	for _, v := range r.revisions {
+		if v.EntryObjectID == entryObjectID {
+			results = append(results, v)
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Revision > results[j].Revision
+	})
+	return results, nil
+}
+
+// FindRevision returns a revision by _id
+func (r *memoryRepository) FindRevision(id primitive.ObjectID) (MongoRevisions, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, v := range r.revisions {
+		if v.ID == id {
+			return v, nil
+		}
+	}
+	return MongoRevisions{}, errNotFound
+}
+
+// FindTags returns all tags ordered by name
+func (r *memoryRepository) FindTags() ([]MongoTags, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	results := append([]MongoTags(nil), r.tags...)
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	return results, nil
+}
+
+// SaveTag inserts or replaces the tag which has same _id
+func (r *memoryRepository) SaveTag(tag MongoTags) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, v := range r.tags {
+		if v.ID == tag.ID {
+			r.tags[i] = tag
+			return nil
+		}
+	}
+	r.tags = append(r.tags, tag)
+	return nil
+}
+
+// DeleteTag deletes a tag by _id
+func (r *memoryRepository) DeleteTag(id primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, v := range r.tags {
+		if v.ID == id {
+			r.tags = append(r.tags[:i], r.tags[i+1:]...)
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+// FindSession returns a session which is not expired by id
+func (r *memoryRepository) FindSession(id string, now time.Time) (MongoSessions, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if v, ok := r.sessions[id]; ok && v.ExpiresAt.After(now) {
+		return v, nil
+	}
+	return MongoSessions{}, errNotFound
+}
+
+// FindSessions returns sessions which are not expired ordered by updatedAt desc
+func (r *memoryRepository) FindSessions(now time.Time) ([]MongoSessions, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var results []MongoSessions
+	for _, v := range r.sessions {
+		if v.ExpiresAt.After(now) {
+			results = append(results, v)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].UpdatedAt.After(results[j].UpdatedAt)
+	})
+	return results, nil
+}
+
+// SaveSession inserts or replaces the session which has same id (createdAt is kept)
+func (r *memoryRepository) SaveSession(session MongoSessions) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, ok := r.sessions[session.ID]; ok {
+		session.CreatedAt = v.CreatedAt
+	}
+	r.sessions[session.ID] = session
+	return nil
+}
+
+// DeleteSession deletes a session by id
+func (r *memoryRepository) DeleteSession(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.sessions[id]; !ok {
+		return errNotFound
+	}
+	delete(r.sessions, id)
+	return nil
+}
+
+// DeleteExpiredSessions deletes sessions which expired
+func (r *memoryRepository) DeleteExpiredSessions(now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for id, v := range r.sessions {
+		if !v.ExpiresAt.After(now) {
+			delete(r.sessions, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func entryCodes(entries []MongoEntries) []string {
+	codes := []string{}
+	for _, v := range entries {
+		codes = append(codes, v.EntryCode)
+	}
+	return codes
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestMemoryRepositoryFindPublished(t *testing.T) {
+	now := time.Now()
+	entries := testEntries(5, now)
+	entries = append(entries, MongoEntries{ID: primitive.NewObjectID(), EntryID: 9, EntryCode: "draft", PublishDate: now.AddDate(0, 0, -1)})
+	r := newMemoryRepository(entries, nil)
+	tests := []struct {
+		name          string
+		offset, limit int
+		want          []string
+	}{
+		{"all", 0, 0, []string{"e5", "e4", "e3", "e2", "e1"}},
+		{"first page", 0, 2, []string{"e5", "e4"}},
+		{"last page", 4, 2, []string{"e1"}},
+		{"out of range", 5, 2, []string{}},
+		{"negative offset", -2, 2, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, err := r.FindPublished(now, tt.offset, tt.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := entryCodes(results); !equalStrings(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryRepositoryFindPublishedByCode(t *testing.T) {
+	now := time.Now()
+	entries := testEntries(2, now)
+	entries = append(entries, MongoEntries{ID: primitive.NewObjectID(), EntryID: 9, EntryCode: "future", PublishDate: now.Add(time.Minute), IsPublished: IsPublished})
+	r := newMemoryRepository(entries, nil)
+	tests := []struct {
+		code string
+		err  error
+	}{
+		{"e1", nil},
+		{"future", errNotFound},
+		{"nothing", errNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			entry, err := r.FindPublishedByCode(tt.code, now)
+			if err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if err == nil && entry.EntryCode != tt.code {
+				t.Errorf("entryCode = %q", entry.EntryCode)
+			}
+		})
+	}
+}
+
+func TestMemoryRepositoryWrite(t *testing.T) {
+	now := time.Now()
+	r := newMemoryRepository(testEntries(2, now), nil)
+	id, err := r.NextEntryID()
+	if err != nil || id != 3 {
+		t.Fatalf("NextEntryID = %d, %v", id, err)
+	}
+	entry := MongoEntries{ID: primitive.NewObjectID(), EntryID: id, EntryCode: "new", PublishDate: now, IsPublished: IsPublished}
+	if err := r.Insert(entry); err != nil {
+		t.Fatal(err)
+	}
+	entry.Title = "updated"
+	if err := r.Update(entry); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := r.FindByCode("new"); err != nil || got.Title != "updated" {
+		t.Fatalf("FindByCode = %+v, %v", got, err)
+	}
+	// 返された値を変更しても保存されている値は変わらない
+	results, _ := r.FindAll()
+	results[0].Tag = append(results[0].Tag, "changed")
+	if got, _ := r.FindByID(results[0].ID); len(got.Tag) != len(results[0].Tag)-1 {
+		t.Errorf("stored tags changed: %v", got.Tag)
+	}
+	if err := r.Delete(entry.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.FindByID(entry.ID); err != errNotFound {
+		t.Errorf("FindByID after Delete: err = %v", err)
+	}
+	if err := r.Delete(entry.ID); err != errNotFound {
+		t.Errorf("Delete twice: err = %v", err)
+	}
+}
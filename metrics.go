@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ContentTypeMetrics - prometheus text exposition format
+const ContentTypeMetrics = "text/plain; version=0.0.4; charset=utf-8"
+
+// histogram buckets (seconds)
+var (
+	httpDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+	dbDurationBuckets   = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1}
+)
+
+// metrics
+// cache hit/missはCacheが持っているcounterをscrape時に出力する
+var (
+	httpRequestsTotal   = newCounterVec("doblog_http_requests_total", "Number of HTTP requests.", "method", "route", "status")
+	httpRequestDuration = newHistogramVec("doblog_http_request_duration_seconds", "HTTP request latencies.", httpDurationBuckets, "method", "route")
+	dbQueryDuration     = newHistogramVec("doblog_db_query_duration_seconds", "Database query latencies.", dbDurationBuckets, "operation")
+	dbQueryErrorsTotal  = newCounterVec("doblog_db_query_errors_total", "Number of failed database queries (not found is not counted).", "operation")
+	loginAttemptsTotal  = newCounterVec("doblog_login_attempts_total", "Number of backend login attempts (success, failure, throttled, locked, totp_required).", "result")
+)
+
+// metricVec - counter or histogram with labels
+type metricVec struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+	// histogram only
+	buckets []float64
+	mu      sync.Mutex
+	// key = label values joined by \xff
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	// counter
+	value float64
+	// histogram (bucketCounts are not cumulative)
+	bucketCounts []uint64
+	sum          float64
+	count        uint64
+}
+
+func newCounterVec(name, help string, labelNames ...string) *metricVec {
+	return &metricVec{name: name, help: help, typ: "counter", labelNames: labelNames, series: make(map[string]*metricSeries)}
+}
+
+func newHistogramVec(name, help string, buckets []float64, labelNames ...string) *metricVec {
+	return &metricVec{name: name, help: help, typ: "histogram", labelNames: labelNames, buckets: buckets, series: make(map[string]*metricSeries)}
+}
+
+// series of the label values (lockしてから呼ぶ)
+func (m *metricVec) get(labelValues []string) *metricSeries {
+	key := strings.Join(labelValues, "\xff")
+	if v, ok := m.series[key]; ok {
+		return v
+	}
+	v := &metricSeries{labelValues: append([]string(nil), labelValues...)}
+	if m.typ == "histogram" {
+		v.bucketCounts = make([]uint64, len(m.buckets))
+	}
+	m.series[key] = v
+	return v
+}
+
+// Inc adds 1 to the counter
+func (m *metricVec) Inc(labelValues ...string) {
+	m.Add(1, labelValues...)
+}
+
+// Add adds v to the counter
+func (m *metricVec) Add(v float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.get(labelValues).value += v
+}
+
+// Observe adds a sample to the histogram
+func (m *metricVec) Observe(v float64, labelValues ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	series := m.get(labelValues)
+	for i, upper := range m.buckets {
+		if v <= upper {
+			series.bucketCounts[i]++
+			break
+		}
+	}
+	series.sum += v
+	series.count++
+}
+
+// write in prometheus text format (series are ordered by label values)
+func (m *metricVec) write(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ)
+	keys := make([]string, 0, len(m.series))
+	for k := range m.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		series := m.series[k]
+		labels := formatMetricLabels(m.labelNames, series.labelValues)
+		if m.typ == "counter" {
+			fmt.Fprintf(w, "%s%s %s\n", m.name, wrapMetricLabels(labels), formatMetricValue(series.value))
+			continue
+		}
+		var cumulative uint64
+		for i, upper := range m.buckets {
+			cumulative += series.bucketCounts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, wrapMetricLabels(joinMetricLabels(labels, `le="`+formatMetricValue(upper)+`"`)), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", m.name, wrapMetricLabels(joinMetricLabels(labels, `le="+Inf"`)), series.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", m.name, wrapMetricLabels(labels), formatMetricValue(series.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", m.name, wrapMetricLabels(labels), series.count)
+	}
+}
+
+// name="value",name="value" (\, ", 改行はescapeする)
+func formatMetricLabels(names, values []string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	pairs := make([]string, 0, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs = append(pairs, name+`="`+replacer.Replace(value)+`"`)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func joinMetricLabels(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+	return labels + "," + label
+}
+
+func wrapMetricLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+	return "{" + labels + "}"
+}
+
+func formatMetricValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// request counter and latency per route (status is written after HTTPErrorHandler)
+func metricsMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		if err := next(c); err != nil {
+			c.Error(err)
+		}
+		// routingされなかったpathはlabelの種類が増え続けるのでまとめる
+		route := c.Path()
+		if route == "" {
+			route = "unmatched"
+		}
+		method := c.Request().Method
+		httpRequestsTotal.Inc(method, route, strconv.Itoa(c.Response().Status))
+		httpRequestDuration.Observe(time.Since(start).Seconds(), method, route)
+		return nil
+	}
+}
+
+// metrics action (/metrics)
+func (s *server) metricsAction(c echo.Context) error {
+	c.Response().Header().Set(echo.HeaderContentType, ContentTypeMetrics)
+	c.Response().WriteHeader(http.StatusOK)
+	w := bufio.NewWriter(c.Response())
+	for _, v := range []*metricVec{httpRequestsTotal, httpRequestDuration, dbQueryDuration, dbQueryErrorsTotal, loginAttemptsTotal} {
+		v.write(w)
+	}
+	s.writeCacheMetrics(w)
+	return w.Flush()
+}
+
+// hits/misses/size of all caches
+func (s *server) writeCacheMetrics(w io.Writer) {
+	stats := s.cacheStats()
+	fmt.Fprint(w, "# HELP doblog_cache_requests_total Number of cache lookups.\n# TYPE doblog_cache_requests_total counter\n")
+	for _, v := range stats {
+		fmt.Fprintf(w, "doblog_cache_requests_total{%s} %d\n", formatMetricLabels([]string{"cache", "result"}, []string{v.Name, "hit"}), v.Hits)
+		fmt.Fprintf(w, "doblog_cache_requests_total{%s} %d\n", formatMetricLabels([]string{"cache", "result"}, []string{v.Name, "miss"}), v.Misses)
+	}
+	fmt.Fprint(w, "# HELP doblog_cache_items Number of cached items.\n# TYPE doblog_cache_items gauge\n")
+	for _, v := range stats {
+		fmt.Fprintf(w, "doblog_cache_items{%s} %d\n", formatMetricLabels([]string{"cache"}, []string{v.Name}), v.Size)
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// metricsRepository - Repository which records query latencies and errors
+// DateMigrator, EntryWatcher等は元のRepositoryを型assertionして使う
+type metricsRepository struct {
+	Repository
+}
+
+func newMetricsRepository(repo Repository) *metricsRepository {
+	return &metricsRepository{Repository: repo}
+}
+
+// record latency and error of an operation (errNotFoundはエラーとして数えない)
+func observeQuery(operation string, start time.Time, err *error) {
+	dbQueryDuration.Observe(time.Since(start).Seconds(), operation)
+	if *err != nil && *err != errNotFound {
+		dbQueryErrorsTotal.Inc(operation)
+	}
+}
+
+func (r *metricsRepository) FindPublished(now time.Time, offset, limit int) (results []MongoEntries, err error) {
+	defer observeQuery("FindPublished", time.Now(), &err)
+	return r.Repository.FindPublished(now, offset, limit)
+}
+
+func (r *metricsRepository) FindPublishedByCode(entryCode string, now time.Time) (result MongoEntries, err error) {
+	defer observeQuery("FindPublishedByCode", time.Now(), &err)
+	return r.Repository.FindPublishedByCode(entryCode, now)
+}
+
+func (r *metricsRepository) FindPublishedByTag(tagName string, now time.Time, offset, limit int) (results []MongoEntries, err error) {
+	defer observeQuery("FindPublishedByTag", time.Now(), &err)
+	return r.Repository.FindPublishedByTag(tagName, now, offset, limit)
+}
+
+func (r *metricsRepository) FindPublishedBetween(from, to, now time.Time) (results []MongoEntries, err error) {
+	defer observeQuery("FindPublishedBetween", time.Now(), &err)
+	return r.Repository.FindPublishedBetween(from, to, now)
+}
+
+func (r *metricsRepository) FindScheduled(after time.Time, limit int) (results []MongoEntries, err error) {
+	defer observeQuery("FindScheduled", time.Now(), &err)
+	return r.Repository.FindScheduled(after, limit)
+}
+
+func (r *metricsRepository) FindAll() (results []MongoEntries, err error) {
+	defer observeQuery("FindAll", time.Now(), &err)
+	return r.Repository.FindAll()
+}
+
+func (r *metricsRepository) FindByID(id primitive.ObjectID) (result MongoEntries, err error) {
+	defer observeQuery("FindByID", time.Now(), &err)
+	return r.Repository.FindByID(id)
+}
+
+func (r *metricsRepository) FindByCode(entryCode string) (result MongoEntries, err error) {
+	defer observeQuery("FindByCode", time.Now(), &err)
+	return r.Repository.FindByCode(entryCode)
+}
+
+func (r *metricsRepository) NextEntryID() (id int32, err error) {
+	defer observeQuery("NextEntryID", time.Now(), &err)
+	return r.Repository.NextEntryID()
+}
+
+func (r *metricsRepository) Insert(entry MongoEntries) (err error) {
+	defer observeQuery("Insert", time.Now(), &err)
+	return r.Repository.Insert(entry)
+}
+
+func (r *metricsRepository) Update(entry MongoEntries) (err error) {
+	defer observeQuery("Update", time.Now(), &err)
+	return r.Repository.Update(entry)
+}
+
+func (r *metricsRepository) Delete(id primitive.ObjectID) (err error) {
+	defer observeQuery("Delete", time.Now(), &err)
+	return r.Repository.Delete(id)
+}
+
+func (r *metricsRepository) ReplaceTags(from []string, to string, updatedAt time.Time) (results []MongoEntries, metas int, err error) {
+	defer observeQuery("ReplaceTags", time.Now(), &err)
+	return r.Repository.ReplaceTags(from, to, updatedAt)
+}
+
+func (r *metricsRepository) FindUserByName(name string) (user MongoUsers, err error) {
+	defer observeQuery("FindUserByName", time.Now(), &err)
+	return r.Repository.FindUserByName(name)
+}
+
+func (r *metricsRepository) FindUserByID(userID int32) (user MongoUsers, err error) {
+	defer observeQuery("FindUserByID", time.Now(), &err)
+	return r.Repository.FindUserByID(userID)
+}
+
+func (r *metricsRepository) UpdateUser(user MongoUsers) (err error) {
+	defer observeQuery("UpdateUser", time.Now(), &err)
+	return r.Repository.UpdateUser(user)
+}
+
+func (r *metricsRepository) InsertRevision(revision MongoRevisions) (err error) {
+	defer observeQuery("InsertRevision", time.Now(), &err)
+	return r.Repository.InsertRevision(revision)
+}
+
+func (r *metricsRepository) FindRevisions(entryObjectID primitive.ObjectID) (results []MongoRevisions, err error) {
+	defer observeQuery("FindRevisions", time.Now(), &err)
+	return r.Repository.FindRevisions(entryObjectID)
+}
+
+func (r *metricsRepository) FindRevision(id primitive.ObjectID) (result MongoRevisions, err error) {
+	defer observeQuery("FindRevision", time.Now(), &err)
+	return r.Repository.FindRevision(id)
+}
+
+func (r *metricsRepository) FindTags() (results []MongoTags, err error) {
+	defer observeQuery("FindTags", time.Now(), &err)
+	return r.Repository.FindTags()
+}
+
+func (r *metricsRepository) SaveTag(tag MongoTags) (err error) {
+	defer observeQuery("SaveTag", time.Now(), &err)
+	return r.Repository.SaveTag(tag)
+}
+
+func (r *metricsRepository) DeleteTag(id primitive.ObjectID) (err error) {
+	defer observeQuery("DeleteTag", time.Now(), &err)
+	return r.Repository.DeleteTag(id)
+}
+
+func (r *metricsRepository) FindSession(id string, now time.Time) (result MongoSessions, err error) {
+	defer observeQuery("FindSession", time.Now(), &err)
+	return r.Repository.FindSession(id, now)
+}
+
+func (r *metricsRepository) FindSessions(now time.Time) (results []MongoSessions, err error) {
+	defer observeQuery("FindSessions", time.Now(), &err)
+	return r.Repository.FindSessions(now)
+}
+
+func (r *metricsRepository) SaveSession(session MongoSessions) (err error) {
+	defer observeQuery("SaveSession", time.Now(), &err)
+	return r.Repository.SaveSession(session)
+}
+
+func (r *metricsRepository) DeleteSession(id string) (err error) {
+	defer observeQuery("DeleteSession", time.Now(), &err)
+	return r.Repository.DeleteSession(id)
+}
+
+func (r *metricsRepository) DeleteExpiredSessions(now time.Time) (n int, err error) {
+	defer observeQuery("DeleteExpiredSessions", time.Now(), &err)
+	return r.Repository.DeleteExpiredSessions(now)
+}
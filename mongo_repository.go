@@ -0,0 +1,600 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsoncodec"
+	"go.mongodb.org/mongo-driver/bson/bsonrw"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoRepository - Repository implementation for MongoDB
+type mongoRepository struct {
+	// db context
+	ctx context.Context
+	// db object
+	client *mongo.Client
+	dbName string
+}
+
+// connect to mongodb
+func newMongoRepository(s Settings) (*mongoRepository, error) {
+	ctx := context.Background()
+	// replicaSet, tls等はURIのoptionで指定する (e.g. ?replicaSet=rs0&tls=true&tlsCAFile=ca.pem)
+	uri := s.DBURI
+	if uri == "" {
+		uri = "mongodb://" + s.DBHost + ":" + s.DBPort
+	}
+	opts := options.Client().ApplyURI(uri).SetRegistry(mongoRegistry())
+	// URIに認証情報が無い場合のみDBUser/DBPasswordを使う (URIのuser, authSourceを上書きしない)
+	if s.DBUser != "" && !mongoURIHasUser(uri) {
+		opts.SetAuth(options.Credential{
+			AuthSource: s.DBName,
+			Username:   s.DBUser,
+			Password:   s.DBPassword,
+		})
+	}
+	client, err := mongo.Connect(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	r := &mongoRepository{ctx: ctx, client: client, dbName: s.DBName}
+	// 同時に保存された場合にrevision番号が重複しないようにする
+	if err := r.createRevisionIndex(); err != nil {
+		appLog.Warn("revision index error", "error", err)
+	}
+	return r, nil
+}
+
+// connection string has a username (user:pass@host)
+// connstring.Parseはmongodb+srvの場合にDNSを引くので、hostの前の部分だけを見る
+func mongoURIHasUser(uri string) bool {
+	i := strings.Index(uri, "://")
+	if i < 0 {
+		return false
+	}
+	hosts := uri[i+3:]
+	if j := strings.IndexAny(hosts, "/?"); j >= 0 {
+		hosts = hosts[:j]
+	}
+	at := strings.LastIndex(hosts, "@")
+	return at > 0 && !strings.HasPrefix(hosts[:at], ":")
+}
+
+// bson registry which decodes legacy string dates into time.Time
+func mongoRegistry() *bsoncodec.Registry {
+	return bson.NewRegistryBuilder().
+		RegisterTypeDecoder(reflect.TypeOf(time.Time{}), bsoncodec.ValueDecoderFunc(decodeTime)).
+		Build()
+}
+
+// 以前のデータは日時を文字列で保存しているのでBSON dateと文字列の両方を読めるようにする
+func decodeTime(_ bsoncodec.DecodeContext, vr bsonrw.ValueReader, val reflect.Value) error {
+	var t time.Time
+	switch vr.Type() {
+	case bsontype.DateTime:
+		ms, err := vr.ReadDateTime()
+		if err != nil {
+			return err
+		}
+		t = time.Unix(ms/1000, ms%1000*int64(time.Millisecond))
+	case bsontype.String:
+		str, err := vr.ReadString()
+		if err != nil {
+			return err
+		}
+		// 不正な値の場合はzero valueとして扱う(1件のために一覧の取得が失敗しないように)
+		t, _ = parseDateTime(str)
+	case bsontype.Null:
+		if err := vr.ReadNull(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("cannot decode %v into time.Time", vr.Type())
+	}
+	val.Set(reflect.ValueOf(t))
+	return nil
+}
+
+// MigrateDates converts string publishDate/createdAt/updatedAt into BSON date
+func (r *mongoRepository) MigrateDates() (int, error) {
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{{Key: "publishDate", Value: bson.D{{Key: "$type", Value: "string"}}}},
+		bson.D{{Key: "createdAt", Value: bson.D{{Key: "$type", Value: "string"}}}},
+		bson.D{{Key: "updatedAt", Value: bson.D{{Key: "$type", Value: "string"}}}},
+	}}}
+	cur, err := r.entries().Find(r.ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cur.Close(r.ctx)
+	migrated := 0
+	for cur.Next(r.ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return migrated, err
+		}
+		// 解析できない値は変換せずに残す
+		set := bson.D{}
+		for _, key := range []string{"publishDate", "createdAt", "updatedAt"} {
+			if str, ok := doc[key].(string); ok {
+				if t, err := parseDateTime(str); err == nil {
+					set = append(set, bson.E{Key: key, Value: t})
+				}
+			}
+		}
+		if len(set) == 0 {
+			continue
+		}
+		if _, err := r.entries().UpdateOne(r.ctx, bson.D{{Key: "_id", Value: doc["_id"]}}, bson.D{{Key: "$set", Value: set}}); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, cur.Err()
+}
+
+// Close disconnects from mongodb
+func (r *mongoRepository) Close() error {
+	return r.client.Disconnect(r.ctx)
+}
+
+func (r *mongoRepository) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx, nil)
+}
+
+func (r *mongoRepository) entries() *mongo.Collection {
+	return r.client.Database(r.dbName).Collection("entries")
+}
+
+func (r *mongoRepository) users() *mongo.Collection {
+	return r.client.Database(r.dbName).Collection("users")
+}
+
+// decode all documents in cursor
+func (r *mongoRepository) decodeEntries(cur *mongo.Cursor) ([]MongoEntries, error) {
+	// findはスライス等で返ってこない - *Cursol型で返ってくるので下記のようにループ回して取得
+	var results []MongoEntries
+	defer cur.Close(r.ctx)
+	for cur.Next(r.ctx) {
+		var result MongoEntries
+		if err := cur.Decode(&result); err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, cur.Err()
+}
+
+// FindPublished returns published entries ordered by publishDate desc
+func (r *mongoRepository) FindPublished(now time.Time, offset, limit int) ([]MongoEntries, error) {
+	findOption := options.Find().SetSort(bson.D{{Key: "publishDate", Value: -1}}).SetSkip(int64(offset)).SetLimit(int64(limit))
+	cur, err := r.entries().Find(r.ctx, publishedFilter(now), findOption)
+	if err != nil {
+		return nil, err
+	}
+	return r.decodeEntries(cur)
+}
+
+// FindPublishedByCode returns a published entry by entryCode
+func (r *mongoRepository) FindPublishedByCode(entryCode string, now time.Time) (MongoEntries, error) {
+	var result MongoEntries
+	err := r.entries().FindOne(r.ctx, append(publishedFilter(now), bson.E{Key: "entryCode", Value: entryCode})).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return result, errNotFound
+	}
+	return result, err
+}
+
+// FindPublishedByTag returns published entries which have the tag
+func (r *mongoRepository) FindPublishedByTag(tagName string, now time.Time, offset, limit int) ([]MongoEntries, error) {
+	findOption := options.Find().SetSort(bson.D{{Key: "publishDate", Value: -1}}).SetSkip(int64(offset)).SetLimit(int64(limit))
+	cur, err := r.entries().Find(r.ctx, append(publishedFilter(now), bson.E{Key: "tag", Value: tagName}), findOption)
+	if err != nil {
+		return nil, err
+	}
+	return r.decodeEntries(cur)
+}
+
+// FindPublishedBetween returns published entries in from <= publishDate < to
+func (r *mongoRepository) FindPublishedBetween(from, to, now time.Time) ([]MongoEntries, error) {
+	findOption := options.Find().SetSort(bson.D{{Key: "publishDate", Value: -1}})
+	filter := bson.D{
+		{Key: "isPublished", Value: IsPublished},
+		{Key: "publishDate", Value: bson.D{{Key: "$gte", Value: from}, {Key: "$lt", Value: to}, {Key: "$lte", Value: now}}},
+	}
+	cur, err := r.entries().Find(r.ctx, filter, findOption)
+	if err != nil {
+		return nil, err
+	}
+	return r.decodeEntries(cur)
+}
+
+// FindScheduled returns published entries whose publishDate is after the time
+func (r *mongoRepository) FindScheduled(after time.Time, limit int) ([]MongoEntries, error) {
+	findOption := options.Find().SetSort(bson.D{{Key: "publishDate", Value: 1}}).SetLimit(int64(limit))
+	filter := bson.D{
+		{Key: "isPublished", Value: IsPublished},
+		{Key: "publishDate", Value: bson.D{{Key: "$gt", Value: after}}},
+	}
+	cur, err := r.entries().Find(r.ctx, filter, findOption)
+	if err != nil {
+		return nil, err
+	}
+	return r.decodeEntries(cur)
+}
+
+// isPublished and publishDate <= now
+func publishedFilter(now time.Time) bson.D {
+	return bson.D{
+		{Key: "isPublished", Value: IsPublished},
+		{Key: "publishDate", Value: bson.D{{Key: "$lte", Value: now}}},
+	}
+}
+
+// FindAll returns all entries ordered by publishDate desc
+func (r *mongoRepository) FindAll() ([]MongoEntries, error) {
+	findOption := options.Find().SetSort(bson.D{{Key: "publishDate", Value: -1}})
+	cur, err := r.entries().Find(r.ctx, bson.D{}, findOption)
+	if err != nil {
+		return nil, err
+	}
+	return r.decodeEntries(cur)
+}
+
+// FindUserByName returns a backend user by name
+func (r *mongoRepository) FindUserByName(name string) (MongoUsers, error) {
+	var user MongoUsers
+	err := r.users().FindOne(r.ctx, bson.D{{Key: "name", Value: name}}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, errNotFound
+	}
+	return user, err
+}
+
+// FindUserByID returns a backend user by userId
+func (r *mongoRepository) FindUserByID(userID int32) (MongoUsers, error) {
+	var user MongoUsers
+	err := r.users().FindOne(r.ctx, bson.D{{Key: "userId", Value: userID}}).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, errNotFound
+	}
+	return user, err
+}
+
+// UpdateUser replaces the user which has same _id
+func (r *mongoRepository) UpdateUser(user MongoUsers) error {
+	res, err := r.users().ReplaceOne(r.ctx, bson.D{{Key: "_id", Value: user.ID}}, user)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// WatchEntries notifies changes of entries collection (replica set required)
+func (r *mongoRepository) WatchEntries(ctx context.Context, onChange func(entry MongoEntries)) error {
+	opts := options.ChangeStream().SetFullDocument(options.UpdateLookup)
+	stream, err := r.entries().Watch(ctx, mongo.Pipeline{}, opts)
+	if err != nil {
+		return err
+	}
+	defer stream.Close(r.ctx)
+	for stream.Next(ctx) {
+		var event struct {
+			FullDocument *MongoEntries `bson:"fullDocument"`
+		}
+		if err := stream.Decode(&event); err != nil {
+			return err
+		}
+		var entry MongoEntries
+		if event.FullDocument != nil {
+			entry = *event.FullDocument
+		}
+		onChange(entry)
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return stream.Err()
+}
+
+// FindByID returns an entry by _id
+func (r *mongoRepository) FindByID(id primitive.ObjectID) (MongoEntries, error) {
+	return r.findOne(bson.D{{Key: "_id", Value: id}})
+}
+
+// FindByCode returns an entry by entryCode
+func (r *mongoRepository) FindByCode(entryCode string) (MongoEntries, error) {
+	return r.findOne(bson.D{{Key: "entryCode", Value: entryCode}})
+}
+
+func (r *mongoRepository) findOne(filter bson.D) (MongoEntries, error) {
+	var result MongoEntries
+	err := r.entries().FindOne(r.ctx, filter).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return result, errNotFound
+	}
+	return result, err
+}
+
+// NextEntryID returns max entryId + 1
+func (r *mongoRepository) NextEntryID() (int32, error) {
+	findOption := options.FindOne().SetSort(bson.D{{Key: "entryId", Value: -1}})
+	var result MongoEntries
+	err := r.entries().FindOne(r.ctx, bson.D{}, findOption).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return 1, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return result.EntryID + 1, nil
+}
+
+// Insert inserts an entry
+func (r *mongoRepository) Insert(entry MongoEntries) error {
+	_, err := r.entries().InsertOne(r.ctx, entry)
+	return err
+}
+
+// Update replaces the entry which has same _id
+func (r *mongoRepository) Update(entry MongoEntries) error {
+	res, err := r.entries().ReplaceOne(r.ctx, bson.D{{Key: "_id", Value: entry.ID}}, entry)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// ReplaceTags replaces tags of all entries which have any of from and tag metadata in one transaction
+// transactionはreplica setでのみ使えるので、standaloneの場合はwarningを出して1件ずつ更新する
+func (r *mongoRepository) ReplaceTags(from []string, to string, updatedAt time.Time) ([]MongoEntries, int, error) {
+	var befores []MongoEntries
+	var metas int
+	err := r.client.UseSession(r.ctx, func(sc mongo.SessionContext) error {
+		_, err := sc.WithTransaction(sc, func(sc mongo.SessionContext) (interface{}, error) {
+			return nil, r.replaceTags(sc, from, to, updatedAt, &befores, &metas)
+		})
+		return err
+	})
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == mongoIllegalOperation {
+		appLog.Warn("mongodb does not support transactions (not a replica set), replacing tags without a transaction", "from", from, "to", to)
+		err = r.replaceTags(r.ctx, from, to, updatedAt, &befores, &metas)
+	}
+	return befores, metas, err
+}
+
+// error code of "Transaction numbers are only allowed on a replica set member or mongos"
+const mongoIllegalOperation = 20
+
+func (r *mongoRepository) replaceTags(ctx context.Context, from []string, to string, updatedAt time.Time, befores *[]MongoEntries, metas *int) error {
+	*befores = nil
+	*metas = 0
+	cur, err := r.entries().Find(ctx, bson.D{{Key: "tag", Value: bson.D{{Key: "$in", Value: from}}}})
+	if err != nil {
+		return err
+	}
+	if err := cur.All(ctx, befores); err != nil {
+		return err
+	}
+	for _, before := range *befores {
+		update := bson.D{{Key: "$set", Value: bson.D{
+			{Key: "tag", Value: replaceTagNames(before.Tag, from, to)},
+			{Key: "updatedAt", Value: updatedAt},
+		}}}
+		if _, err := r.entries().UpdateOne(ctx, bson.D{{Key: "_id", Value: before.ID}}, update); err != nil {
+			return err
+		}
+	}
+	cur, err = r.tags().Find(ctx, bson.D{})
+	if err != nil {
+		return err
+	}
+	var tags []MongoTags
+	if err := cur.All(ctx, &tags); err != nil {
+		return err
+	}
+	saves, deletes := replaceTagMetaDocs(tags, from, to)
+	for _, v := range saves {
+		if _, err := r.tags().ReplaceOne(ctx, bson.D{{Key: "_id", Value: v.ID}}, v); err != nil {
+			return err
+		}
+	}
+	for _, id := range deletes {
+		if _, err := r.tags().DeleteOne(ctx, bson.D{{Key: "_id", Value: id}}); err != nil {
+			return err
+		}
+	}
+	*metas = len(saves) + len(deletes)
+	return nil
+}
+
+// Delete deletes an entry by _id
+func (r *mongoRepository) Delete(id primitive.ObjectID) error {
+	res, err := r.entries().DeleteOne(r.ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+func (r *mongoRepository) revisions() *mongo.Collection {
+	return r.client.Database(r.dbName).Collection("revisions")
+}
+
+// unique index of entryObjectId + revision
+func (r *mongoRepository) createRevisionIndex() error {
+	_, err := r.revisions().Indexes().CreateOne(r.ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "entryObjectId", Value: 1}, {Key: "revision", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// error code of duplicate key
+const mongoDuplicateKey = 11000
+
+// InsertRevision inserts a revision
+func (r *mongoRepository) InsertRevision(revision MongoRevisions) error {
+	_, err := r.revisions().InsertOne(r.ctx, revision)
+	var writeErr mongo.WriteException
+	if errors.As(err, &writeErr) {
+		for _, v := range writeErr.WriteErrors {
+			if v.Code == mongoDuplicateKey {
+				return errDuplicateRevision
+			}
+		}
+	}
+	return err
+}
+
+// FindRevisions returns revisions of the entry ordered by revision desc
+func (r *mongoRepository) FindRevisions(entryObjectID primitive.ObjectID) ([]MongoRevisions, error) {
+	findOption := options.Find().SetSort(bson.D{{Key: "revision", Value: -1}})
+	cur, err := r.revisions().Find(r.ctx, bson.D{{Key: "entryObjectId", Value: entryObjectID}}, findOption)
+	if err != nil {
+		return nil, err
+	}
+	var results []MongoRevisions
+	defer cur.Close(r.ctx)
+	for cur.Next(r.ctx) {
+		var result MongoRevisions
+		if err := cur.Decode(&result); err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, cur.Err()
+}
+
+// FindRevision returns a revision by _id
+func (r *mongoRepository) FindRevision(id primitive.ObjectID) (MongoRevisions, error) {
+	var result MongoRevisions
+	err := r.revisions().FindOne(r.ctx, bson.D{{Key: "_id", Value: id}}).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return result, errNotFound
+	}
+	return result, err
+}
+
+func (r *mongoRepository) tags() *mongo.Collection {
+	return r.client.Database(r.dbName).Collection("tags")
+}
+
+// FindTags returns all tags ordered by name
+func (r *mongoRepository) FindTags() ([]MongoTags, error) {
+	findOption := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+	cur, err := r.tags().Find(r.ctx, bson.D{}, findOption)
+	if err != nil {
+		return nil, err
+	}
+	var results []MongoTags
+	if err := cur.All(r.ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// SaveTag inserts or replaces the tag which has same _id
+func (r *mongoRepository) SaveTag(tag MongoTags) error {
+	_, err := r.tags().ReplaceOne(r.ctx, bson.D{{Key: "_id", Value: tag.ID}}, tag, options.Replace().SetUpsert(true))
+	return err
+}
+
+// DeleteTag deletes a tag by _id
+func (r *mongoRepository) DeleteTag(id primitive.ObjectID) error {
+	res, err := r.tags().DeleteOne(r.ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+func (r *mongoRepository) sessions() *mongo.Collection {
+	return r.client.Database(r.dbName).Collection("sessions")
+}
+
+// FindSession returns a session which is not expired by id
+func (r *mongoRepository) FindSession(id string, now time.Time) (MongoSessions, error) {
+	var result MongoSessions
+	filter := bson.D{{Key: "_id", Value: id}, {Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: now}}}}
+	err := r.sessions().FindOne(r.ctx, filter).Decode(&result)
+	if err == mongo.ErrNoDocuments {
+		return result, errNotFound
+	}
+	return result, err
+}
+
+// FindSessions returns sessions which are not expired ordered by updatedAt desc
+func (r *mongoRepository) FindSessions(now time.Time) ([]MongoSessions, error) {
+	findOption := options.Find().SetSort(bson.D{{Key: "updatedAt", Value: -1}})
+	cur, err := r.sessions().Find(r.ctx, bson.D{{Key: "expiresAt", Value: bson.D{{Key: "$gt", Value: now}}}}, findOption)
+	if err != nil {
+		return nil, err
+	}
+	var results []MongoSessions
+	if err := cur.All(r.ctx, &results); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// SaveSession inserts or replaces the session which has same id (createdAt is kept)
+func (r *mongoRepository) SaveSession(session MongoSessions) error {
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "userId", Value: session.UserID},
+			{Key: "data", Value: session.Data},
+			{Key: "remoteIp", Value: session.RemoteIP},
+			{Key: "userAgent", Value: session.UserAgent},
+			{Key: "updatedAt", Value: session.UpdatedAt},
+			{Key: "expiresAt", Value: session.ExpiresAt},
+		}},
+		{Key: "$setOnInsert", Value: bson.D{{Key: "createdAt", Value: session.CreatedAt}}},
+	}
+	_, err := r.sessions().UpdateOne(r.ctx, bson.D{{Key: "_id", Value: session.ID}}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+// DeleteSession deletes a session by id
+func (r *mongoRepository) DeleteSession(id string) error {
+	res, err := r.sessions().DeleteOne(r.ctx, bson.D{{Key: "_id", Value: id}})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// DeleteExpiredSessions deletes sessions which expired
+func (r *mongoRepository) DeleteExpiredSessions(now time.Time) (int, error) {
+	res, err := r.sessions().DeleteMany(r.ctx, bson.D{{Key: "expiresAt", Value: bson.D{{Key: "$lte", Value: now}}}})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.DeletedCount), nil
+}
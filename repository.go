@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// errNotFound is returned by repositories when no document matches
+var errNotFound = errors.New("not found")
+
+// errDuplicateRevision is returned by InsertRevision when the entry already has the revision number
+var errDuplicateRevision = errors.New("revision already exists")
+
+// EntryRepository - access to entries
+type EntryRepository interface {
+	// published entries (publishDate <= now) ordered by publishDate desc, limit 0 = no limit
+	FindPublished(now time.Time, offset, limit int) ([]MongoEntries, error)
+	// a published entry (publishDate <= now) by entryCode
+	FindPublishedByCode(entryCode string, now time.Time) (MongoEntries, error)
+	// published entries (publishDate <= now) which have the tag, ordered by publishDate desc, limit 0 = no limit
+	FindPublishedByTag(tagName string, now time.Time, offset, limit int) ([]MongoEntries, error)
+	// published entries (publishDate <= now) in from <= publishDate < to, ordered by publishDate desc
+	FindPublishedBetween(from, to, now time.Time) ([]MongoEntries, error)
+	// published entries scheduled after the time (publishDate > after) ordered by publishDate asc, limit 0 = no limit
+	FindScheduled(after time.Time, limit int) ([]MongoEntries, error)
+	// all entries (including unpublished) ordered by publishDate desc
+	FindAll() ([]MongoEntries, error)
+	// an entry by _id (including unpublished)
+	FindByID(id primitive.ObjectID) (MongoEntries, error)
+	// an entry by entryCode (including unpublished)
+	FindByCode(entryCode string) (MongoEntries, error)
+	// max entryId + 1
+	NextEntryID() (int32, error)
+	Insert(entry MongoEntries) error
+	// replace the entry which has same _id
+	Update(entry MongoEntries) error
+	Delete(id primitive.ObjectID) error
+	// replace tags in from with to (to == "" removes them) in all entries and tag metadata (replaceTagMetaDocs) at once
+	// returns the entries before the change and number of changed tag metadata
+	ReplaceTags(from []string, to string, updatedAt time.Time) ([]MongoEntries, int, error)
+}
+
+// UserRepository - access to backend users
+type UserRepository interface {
+	FindUserByName(name string) (MongoUsers, error)
+	// find by userId (not _id)
+	FindUserByID(userID int32) (MongoUsers, error)
+	// replace the user which has same _id
+	UpdateUser(user MongoUsers) error
+}
+
+// RevisionRepository - access to entry revision history
+type RevisionRepository interface {
+	// errDuplicateRevision if the entry already has the revision number (entryObjectId + revisionはunique)
+	InsertRevision(revision MongoRevisions) error
+	// revisions of the entry ordered by revision desc
+	FindRevisions(entryObjectID primitive.ObjectID) ([]MongoRevisions, error)
+	FindRevision(id primitive.ObjectID) (MongoRevisions, error)
+}
+
+// TagRepository - access to tag metadata
+type TagRepository interface {
+	// all tags ordered by name
+	FindTags() ([]MongoTags, error)
+	// insert or replace the tag which has same _id
+	SaveTag(tag MongoTags) error
+	DeleteTag(id primitive.ObjectID) error
+}
+
+// SessionRepository - access to server-side sessions
+type SessionRepository interface {
+	// a session by id (expired sessions are not found)
+	FindSession(id string, now time.Time) (MongoSessions, error)
+	// sessions which are not expired ordered by updatedAt desc
+	FindSessions(now time.Time) ([]MongoSessions, error)
+	// insert or replace the session which has same id (createdAt of an existing session is kept)
+	SaveSession(session MongoSessions) error
+	DeleteSession(id string) error
+	// delete sessions which expired (expiresAt <= now), returns number of deleted sessions
+	DeleteExpiredSessions(now time.Time) (int, error)
+}
+
+// DateMigrator - repositories which can convert legacy string dates to typed dates
+type DateMigrator interface {
+	// returns number of migrated documents
+	MigrateDates() (int, error)
+}
+
+// Pinger - connection check for readiness
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Repository - storage backend for doblog
+type Repository interface {
+	EntryRepository
+	UserRepository
+	RevisionRepository
+	TagRepository
+	SessionRepository
+	Pinger
+	Close() error
+}
+
+// open storage backend selected by [db] Driver
+// memoryの場合はDBPathのjsonを読み込む(mongodを使わないローカル確認用)
+func openRepository() (Repository, error) {
+	switch settings.DBDriver {
+	case DriverSQLite:
+		return newSqliteRepository(settings)
+	case DriverMemory:
+		return loadMemoryRepository(settings.DBPath)
+	}
+	return newMongoRepository(settings)
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// retries of saveRevision when another save took the same revision number
+const maxRevisionRetries = 5
+
+// save a snapshot of the entry as a new revision
+// 番号は最新+1, 同時に保存されて重複した場合(errDuplicateRevision)は番号を取り直す
+func (s *server) saveRevision(before []MongoEntries, entry MongoEntries, savedBy int32) error {
+	var err error
+	for i := 0; i < maxRevisionRetries; i++ {
+		if err = s.insertRevision(before, entry, savedBy); err != errDuplicateRevision {
+			return err
+		}
+	}
+	return err
+}
+
+// before (更新前の内容) はrevisionが1件も無い場合(履歴機能の導入前に作成されたentry)のみ先に保存する
+func (s *server) insertRevision(before []MongoEntries, entry MongoEntries, savedBy int32) error {
+	revisions, err := s.revisions.FindRevisions(entry.ID)
+	if err != nil {
+		return err
+	}
+	var revision int32 = 1
+	if len(revisions) > 0 {
+		revision = revisions[0].Revision + 1
+	} else {
+		for _, v := range before {
+			err := s.revisions.InsertRevision(MongoRevisions{
+				ID:            primitive.NewObjectID(),
+				EntryObjectID: v.ID,
+				Revision:      revision,
+				Entry:         v,
+				SavedBy:       v.AuthorID,
+				SavedAt:       v.UpdatedAt,
+			})
+			if err != nil {
+				return err
+			}
+			revision++
+		}
+	}
+	return s.revisions.InsertRevision(MongoRevisions{
+		ID:            primitive.NewObjectID(),
+		EntryObjectID: entry.ID,
+		Revision:      revision,
+		Entry:         entry,
+		SavedBy:       savedBy,
+		SavedAt:       time.Now(),
+	})
+}
+
+// entryは保存済みなのでrevisionの保存に失敗してもエラーにはしない
+func (s *server) saveRevisionOrLog(entry MongoEntries, savedBy int32, before ...MongoEntries) {
+	if err := s.saveRevision(before, entry, savedBy); err != nil {
+		appLog.Error("save revision error", "entry_id", entry.EntryID, "error", err)
+	}
+}
+
+// revisions of an entry (id = entry _id)
+func (s *server) getRevisions(id string) ([]MongoRevisions, error) {
+	objectID, err := parseEntryID(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.revisions.FindRevisions(objectID)
+}
+
+func (s *server) getRevision(id string) (MongoRevisions, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return MongoRevisions{}, &ValidationError{Field: "revisionId", Message: "invalid id"}
+	}
+	return s.revisions.FindRevision(objectID)
+}
+
+// text for diff (title, entryCode, publishDate, tags and content)
+func revisionText(revision MongoRevisions) string {
+	return "title: " + revision.Entry.Title + "\n" +
+		"entryCode: " + revision.Entry.EntryCode + "\n" +
+		"publishDate: " + revision.Entry.PublishDate.In(siteLocation()).Format(DateTimeFormat) + "\n" +
+		"tag: " + strings.Join(revision.Entry.Tag, ", ") + "\n" +
+		"\n" + revision.Entry.Content
+}
+
+// unified diff between two revisions of the same entry
+func (s *server) diffRevisions(fromID, toID string) (string, error) {
+	from, err := s.getRevision(fromID)
+	if err != nil {
+		return "", err
+	}
+	to, err := s.getRevision(toID)
+	if err != nil {
+		return "", err
+	}
+	if from.EntryObjectID != to.EntryObjectID {
+		return "", &ValidationError{Field: "revisionId", Message: "revisions of different entries"}
+	}
+	return unifiedDiff("revision "+strconv.Itoa(int(from.Revision)), "revision "+strconv.Itoa(int(to.Revision)),
+		revisionText(from), revisionText(to)), nil
+}
+
+// restore content of an older revision (isPublished is kept, saved as a new revision)
+func (s *server) restoreRevision(id string, savedBy int32) (MongoEntries, error) {
+	revision, err := s.getRevision(id)
+	if err != nil {
+		return MongoEntries{}, err
+	}
+	current, err := s.entries.FindByID(revision.EntryObjectID)
+	if err != nil {
+		return MongoEntries{}, err
+	}
+	return s.updateEntry(EntryInput{
+		ID:          current.ID.Hex(),
+		EntryCode:   revision.Entry.EntryCode,
+		PublishDate: revision.Entry.PublishDate.In(siteLocation()).Format(DateTimeFormat),
+		Title:       revision.Entry.Title,
+		Content:     revision.Entry.Content,
+		Tag:         revision.Entry.Tag,
+		IsPublished: current.IsPublished,
+	}, savedBy)
+}
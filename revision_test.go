@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// staleRevisionRepository - FindRevisions returns nothing the first stale times (同時に保存された場合と同じ状態)
+type staleRevisionRepository struct {
+	RevisionRepository
+	stale int
+}
+
+func (r *staleRevisionRepository) FindRevisions(entryObjectID primitive.ObjectID) ([]MongoRevisions, error) {
+	if r.stale > 0 {
+		r.stale--
+		return nil, nil
+	}
+	return r.RevisionRepository.FindRevisions(entryObjectID)
+}
+
+func TestSaveRevision(t *testing.T) {
+	entry := testEntries(1, time.Now())[0]
+	tests := []struct {
+		name  string
+		stale int
+		err   error
+		want  []int32
+	}{
+		{"next number", 0, nil, []int32{2, 1}},
+		{"retry on duplicate", 2, nil, []int32{2, 1}},
+		{"give up", maxRevisionRetries, errDuplicateRevision, []int32{1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository([]MongoEntries{entry}, nil)
+			s, _ := newTestServer(t, repo)
+			if err := s.saveRevision(nil, entry, 1); err != nil {
+				t.Fatal(err)
+			}
+			s.revisions = &staleRevisionRepository{RevisionRepository: repo, stale: tt.stale}
+			if err := s.saveRevision(nil, entry, 1); err != tt.err {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			revisions, _ := repo.FindRevisions(entry.ID)
+			var got []int32
+			for _, v := range revisions {
+				got = append(got, v.Revision)
+			}
+			if len(got) != len(tt.want) || got[0] != tt.want[0] {
+				t.Errorf("revisions = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// echo with middlewares and routes of the blog and the backend (testからも使う)
+func (s *server) newRouter(sessionStore sessions.Store) *echo.Echo {
+	e := echo.New()
+	e.HideBanner = true
+	e.IPExtractor = newIPExtractor(settings)
+	// X-Request-IDをaccess logとapp logに出力する
+	e.Use(middleware.RequestID())
+	e.Use(accessLogMiddleware)
+	if settings.MetricsEnabled {
+		e.Use(metricsMiddleware)
+	}
+	// <input type="hidden" name="csrf" value="dfasjkjhl(random文字列)" ～ではなく
+	// Phalconのように <input type="hidden" name="jfuioashfg;lsa(random文字列)" value="dfasjkjhl(random文字列)"としたいので非採用
+	// random文字列の生成についてはechoに準拠(auth.go参照)
+	// ---
+	// echo v4.2でSameSite設定がきた https://github.com/labstack/echo/pull/1524/files/8b2c77b1079c17fc9d7b1b420b2c3102c4069d6f
+	/*e.Use(middleware.CSRFWithConfig(middleware.CSRFConfig{
+		TokenLookup:    "form:csrftoken",
+		CookiePath:     settings.RootPath + settings.BackendURI,
+		CookieHTTPOnly: true,
+		CookieMaxAge:   0,
+		CookieName:     "_dct",
+		CookieSecure:   !isDevelopment(), // 開発環境ではfalse
+		CookieSameSite: http.SameSiteStrictMode,
+	}))*/
+	e.Use(session.Middleware(sessionStore))
+	e.Static(settings.RootPath+"files", "./files")
+	e.File("/favicon.ico", "files/images/favicon.ico")
+	e.GET("/robots.txt", robotsAction)
+	e.GET("/healthz", s.healthzAction)
+	e.GET("/readyz", s.readyzAction)
+	e.Renderer = getTemplateRenderer()
+	e.GET(settings.RootPath, s.indexAction)
+	e.GET(settings.RootPath+":entry_code", s.entryAction)
+	e.GET(settings.RootPath+"feed.xml", s.rssAction)
+	e.GET(settings.RootPath+"atom.xml", s.atomAction)
+	e.GET(settings.RootPath+"feed.json", s.jsonFeedAction)
+	e.GET(settings.RootPath+"sitemap.xml", s.sitemapAction)
+	e.GET(settings.RootPath+"sitemap-:num", s.sitemapAction)
+	e.GET(settings.RootPath+"search", s.searchAction)
+	e.GET(settings.RootPath+"page/:num", s.pageAction)
+	e.GET(settings.RootPath+"tag/:tagName", s.tagAction)
+	e.GET(settings.RootPath+"tag/:tagName/page/:num", s.tagAction)
+	e.GET(settings.RootPath+"archive/:year/", s.archiveAction)
+	e.GET(settings.RootPath+"archive/:year/:month/", s.archiveAction)
+	e.GET(settings.RootPath+"tag/:tagName/feed.xml", s.rssAction)
+	e.GET(settings.RootPath+"tag/:tagName/atom.xml", s.atomAction)
+	e.GET(settings.RootPath+"tag/:tagName/feed.json", s.jsonFeedAction)
+	e.GET(settings.RootPath+"error/:code", errorAction)
+	e.GET(settings.RootPath+settings.BackendURI, backendLoginAction)
+	e.POST(settings.RootPath+settings.BackendURI, s.authenticationAction, csrfMiddleware(invalidLoginTokenAction))
+	e.GET(settings.RootPath+settings.BackendURI+"totp", s.totpLoginAction)
+	e.POST(settings.RootPath+settings.BackendURI+"totp", s.totpAuthenticationAction, csrfMiddleware(invalidTOTPTokenAction))
+	e.POST(settings.RootPath+settings.BackendURI+"logout", logoutAction, csrfMiddleware(nil))
+	e.GET(settings.RootPath+settings.BackendURI+"manager/", s.managerAction)
+	e.GET(settings.RootPath+settings.BackendURI+"manager/api/:param", s.apiGetAction)
+	e.POST(settings.RootPath+settings.BackendURI+"manager/api/:param", s.apiPostAction, apiCSRFMiddleware())
+	e.HTTPErrorHandler = errorHandler
+	// metrics (Portが空の場合はblogと同じportで公開する)
+	if settings.MetricsEnabled && settings.MetricsPort == "" {
+		e.GET("/metrics", s.metricsAction)
+	}
+	return e
+}
+
+// client ip of c.RealIP() (login throttling, logs, sessions)
+// X-Forwarded-Forは[app] TrustedProxiesから来たrequestのみ使う (空の場合は接続元のip)
+func newIPExtractor(s Settings) echo.IPExtractor {
+	if len(s.TrustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+	// echoの標準ではprivate networkも信頼するので無効にする
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, v := range s.TrustedProxies {
+		options = append(options, echo.TrustIPRange(v))
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// 次の予約投稿が無い場合も外部(mongo shell等)での変更に備えてこの間隔で再確認する
+const schedulerMaxWait = 10 * time.Minute
+
+// wake the scheduler up to recalculate the next publish time (non-blocking)
+func (s *server) reschedule() {
+	select {
+	case s.rescheduleCh <- struct{}{}:
+	default:
+	}
+}
+
+// purge caches at the moment scheduled entries go live, until ctx is done
+func (s *server) runPublishScheduler(ctx context.Context) {
+	lastRun := time.Now()
+	for {
+		wait := schedulerMaxWait
+		next, err := s.entries.FindScheduled(lastRun, 1)
+		if err != nil {
+			appLog.Error("publish scheduler error", "error", err)
+		} else if len(next) > 0 {
+			if d := time.Until(next[0].PublishDate); d < wait {
+				wait = d
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.rescheduleCh:
+			timer.Stop()
+		case <-timer.C:
+			now := time.Now()
+			s.publishScheduled(lastRun, now)
+			lastRun = now
+		}
+	}
+}
+
+// purge caches of entries which went live in (from, to]
+func (s *server) publishScheduled(from, to time.Time) {
+	entries, err := s.entries.FindScheduled(from, 0)
+	if err != nil {
+		appLog.Error("publish scheduler error", "error", err)
+		return
+	}
+	var published []MongoEntries
+	for _, v := range entries {
+		if !v.PublishDate.After(to) {
+			published = append(published, v)
+		}
+	}
+	if len(published) > 0 {
+		s.invalidateEntry(published...)
+	}
+}
@@ -0,0 +1,394 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"math"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/labstack/echo/v4"
+	"github.com/russross/blackfriday/v2"
+)
+
+const (
+	// max results of search page
+	SearchMaxResults = 50
+	// max length of query (runes)
+	SearchMaxQuery = 100
+	// snippet length and context before the first match (runes)
+	searchSnippetLength = 120
+	searchSnippetBefore = 30
+)
+
+// score weights of matched fields
+const (
+	searchWeightTitle   = 5.0
+	searchWeightTag     = 3.0
+	searchWeightContent = 1.0
+)
+
+// SearchResult - view item of search page (Title, Snippet are highlighted html)
+type SearchResult struct {
+	URI         string
+	PublishDate time.Time
+	Title       template.HTML
+	Snippet     template.HTML
+	Tags        []TagItem
+	tagNames    []string
+	score       float64
+}
+
+type searchDoc struct {
+	entry MongoEntries
+	// original text and normalized text (same length, rune単位で位置が対応する)
+	title       []rune
+	content     []rune
+	normTitle   []rune
+	normContent []rune
+	normTags    [][]rune
+}
+
+// SearchIndex - in-memory character n-gram index of published entries
+// 日本語は空白で単語を区切れないので、文字unigram + bigramで転置indexを作る
+type SearchIndex struct {
+	mu   sync.RWMutex
+	docs []searchDoc
+	// n-gram -> doc indexes (asc)
+	postings map[string][]int
+	// Invalidateでgenerationを進め、builtと違う場合は次の検索時に作り直す
+	generation uint64
+	built      uint64
+	// serialize rebuilds
+	buildMu sync.Mutex
+}
+
+func newSearchIndex() *SearchIndex {
+	return &SearchIndex{postings: map[string][]int{}, generation: 1}
+}
+
+// mark the index stale (rebuilt on next search)
+func (idx *SearchIndex) Invalidate() {
+	idx.mu.Lock()
+	idx.generation++
+	idx.mu.Unlock()
+}
+
+// rebuild the index from load() if stale
+func (idx *SearchIndex) ensure(load func() ([]MongoEntries, error)) error {
+	idx.buildMu.Lock()
+	defer idx.buildMu.Unlock()
+	idx.mu.RLock()
+	generation, built := idx.generation, idx.built
+	idx.mu.RUnlock()
+	if generation == built {
+		return nil
+	}
+	entries, err := load()
+	if err != nil {
+		return err
+	}
+	docs := make([]searchDoc, 0, len(entries))
+	postings := make(map[string][]int)
+	for _, entry := range entries {
+		doc := newSearchDoc(entry)
+		grams := make(map[string]struct{})
+		addSearchGrams(grams, doc.normTitle)
+		addSearchGrams(grams, doc.normContent)
+		for _, t := range doc.normTags {
+			addSearchGrams(grams, t)
+		}
+		for g := range grams {
+			postings[g] = append(postings[g], len(docs))
+		}
+		docs = append(docs, doc)
+	}
+	// 構築中に変更があった場合はgenerationが進んでいるので次回また作り直される
+	idx.mu.Lock()
+	idx.docs = docs
+	idx.postings = postings
+	idx.built = generation
+	idx.mu.Unlock()
+	return nil
+}
+
+// search entries which contain all terms of the query, ordered by score desc
+func (idx *SearchIndex) Search(query string, limit int) []SearchResult {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return nil
+	}
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	var candidates []int
+	for i, term := range terms {
+		for j, g := range termGrams(term) {
+			if i == 0 && j == 0 {
+				candidates = idx.postings[g]
+				continue
+			}
+			candidates = intersectPostings(candidates, idx.postings[g])
+		}
+	}
+	var results []SearchResult
+	for _, i := range candidates {
+		doc := idx.docs[i]
+		// n-gramが全て含まれていても語として連続しているとは限らないので実際の出現で確認する
+		score := 0.0
+		matched := true
+		for _, term := range terms {
+			tagCount := 0
+			for _, t := range doc.normTags {
+				tagCount += countRunes(t, term)
+			}
+			termScore := searchWeightTitle*float64(countRunes(doc.normTitle, term)) +
+				searchWeightTag*float64(tagCount) +
+				searchWeightContent*math.Log1p(float64(countRunes(doc.normContent, term)))
+			if termScore == 0 {
+				matched = false
+				break
+			}
+			score += termScore
+		}
+		if !matched {
+			continue
+		}
+		results = append(results, SearchResult{
+			URI:         settings.RootPath + doc.entry.EntryCode,
+			PublishDate: doc.entry.PublishDate,
+			Title:       highlight(doc.title, doc.normTitle, terms, 0, len(doc.title)),
+			Snippet:     snippet(doc, terms),
+			tagNames:    doc.entry.Tag,
+			score:       score,
+		})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].PublishDate.After(results[j].PublishDate)
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+var htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+
+func newSearchDoc(entry MongoEntries) searchDoc {
+	// markdown -> html -> text
+	body := string(blackfriday.Run([]byte(strings.ReplaceAll(entry.Content, MoreLinkString, ""))))
+	body = html.UnescapeString(htmlTagPattern.ReplaceAllString(body, " "))
+	doc := searchDoc{
+		entry:   entry,
+		title:   []rune(entry.Title),
+		content: []rune(strings.Join(strings.Fields(body), " ")),
+	}
+	doc.normTitle = normalizeRunes(doc.title)
+	doc.normContent = normalizeRunes(doc.content)
+	for _, t := range entry.Tag {
+		doc.normTags = append(doc.normTags, normalizeRunes([]rune(t)))
+	}
+	return doc
+}
+
+// 全角英数 -> 半角, カタカナ -> ひらがな, 大文字 -> 小文字 (1文字ずつ変換するので長さは変わらない)
+func normalizeRunes(text []rune) []rune {
+	norm := make([]rune, len(text))
+	for i, r := range text {
+		switch {
+		case r >= 0xFF01 && r <= 0xFF5E:
+			r -= 0xFEE0
+		case r == 0x3000:
+			r = ' '
+		case r >= 0x30A1 && r <= 0x30F6:
+			r -= 0x60
+		}
+		norm[i] = unicode.ToLower(r)
+	}
+	return norm
+}
+
+func isSearchRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// split normalized query into terms (runs of letters/digits, duplicates removed)
+func searchTerms(query string) [][]rune {
+	var terms [][]rune
+	seen := make(map[string]bool)
+	for _, field := range strings.FieldsFunc(string(normalizeRunes([]rune(query))), func(r rune) bool { return !isSearchRune(r) }) {
+		if !seen[field] {
+			seen[field] = true
+			terms = append(terms, []rune(field))
+		}
+	}
+	return terms
+}
+
+// n-grams to look up a term (1文字の場合はunigram, それ以外はbigram)
+func termGrams(term []rune) []string {
+	if len(term) == 1 {
+		return []string{string(term)}
+	}
+	grams := make([]string, 0, len(term)-1)
+	for i := 0; i+1 < len(term); i++ {
+		grams = append(grams, string(term[i:i+2]))
+	}
+	return grams
+}
+
+// add unigrams and bigrams of each letter/digit run
+func addSearchGrams(grams map[string]struct{}, text []rune) {
+	for i, r := range text {
+		if !isSearchRune(r) {
+			continue
+		}
+		grams[string(r)] = struct{}{}
+		if i+1 < len(text) && isSearchRune(text[i+1]) {
+			grams[string(text[i:i+2])] = struct{}{}
+		}
+	}
+}
+
+func intersectPostings(a, b []int) []int {
+	var result []int
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		switch {
+		case a[i] < b[j]:
+			i++
+		case a[i] > b[j]:
+			j++
+		default:
+			result = append(result, a[i])
+			i++
+			j++
+		}
+	}
+	return result
+}
+
+// position of the longest term at text[i:] (length 0 = no match)
+func matchTermAt(text []rune, i int, terms [][]rune) int {
+	length := 0
+	for _, term := range terms {
+		if len(term) > length && hasRunesPrefix(text[i:], term) {
+			length = len(term)
+		}
+	}
+	return length
+}
+
+func hasRunesPrefix(text, prefix []rune) bool {
+	if len(text) < len(prefix) {
+		return false
+	}
+	for i, r := range prefix {
+		if text[i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+func countRunes(text, term []rune) int {
+	count := 0
+	for i := 0; i+len(term) <= len(text); i++ {
+		if hasRunesPrefix(text[i:], term) {
+			count++
+			i += len(term) - 1
+		}
+	}
+	return count
+}
+
+// escape text[start:end] and wrap matched terms with <mark>
+func highlight(text, norm []rune, terms [][]rune, start, end int) template.HTML {
+	var b strings.Builder
+	for i := start; i < end; {
+		if n := matchTermAt(norm, i, terms); n > 0 {
+			if i+n > end {
+				n = end - i
+			}
+			b.WriteString("<mark>" + html.EscapeString(string(text[i:i+n])) + "</mark>")
+			i += n
+			continue
+		}
+		b.WriteString(html.EscapeString(string(text[i])))
+		i++
+	}
+	return template.HTML(b.String())
+}
+
+// part of content around the first match (無い場合は先頭から)
+func snippet(doc searchDoc, terms [][]rune) template.HTML {
+	start := 0
+	for i := range doc.normContent {
+		if matchTermAt(doc.normContent, i, terms) > 0 {
+			start = i - searchSnippetBefore
+			break
+		}
+	}
+	if start < 0 {
+		start = 0
+	}
+	end := start + searchSnippetLength
+	if end > len(doc.content) {
+		end = len(doc.content)
+	}
+	body := highlight(doc.content, doc.normContent, terms, start, end)
+	if start > 0 {
+		body = "…" + body
+	}
+	if end < len(doc.content) {
+		body += "…"
+	}
+	return body
+}
+
+// search published entries (index is rebuilt after entry changes)
+func (s *server) searchEntries(query string) ([]SearchResult, error) {
+	err := s.searchIndex.ensure(func() ([]MongoEntries, error) {
+		return s.entries.FindPublished(time.Now(), 0, 0)
+	})
+	if err != nil {
+		return nil, err
+	}
+	results := s.searchIndex.Search(query, SearchMaxResults)
+	// tagのURIはslugの変更があるのでindexには持たない
+	for i := range results {
+		results[i].Tags = s.toTagItems(results[i].tagNames)
+	}
+	return results, nil
+}
+
+// search action (search?q=)
+func (s *server) searchAction(c echo.Context) error {
+	query := strings.TrimSpace(c.QueryParam("q"))
+	if utf8.RuneCountInString(query) > SearchMaxQuery {
+		query = string([]rune(query)[:SearchMaxQuery])
+	}
+	var results []SearchResult
+	if query != "" {
+		var err error
+		results, err = s.searchEntries(query)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+		}
+	}
+	return c.Render(http.StatusOK, "search.html", map[string]interface{}{
+		"title":     "search : " + query,
+		"root_path": settings.RootPath,
+		"query":     query,
+		"results":   results,
+		"tags":      s.getTagsAll(),
+		"archives":  s.getArchives(),
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testSearchEntries(now time.Time) []MongoEntries {
+	entry := func(code, title, content string, tags ...string) MongoEntries {
+		return MongoEntries{ID: primitive.NewObjectID(), EntryCode: code, Title: title, Content: content, Tag: tags, PublishDate: now, IsPublished: IsPublished}
+	}
+	return []MongoEntries{
+		entry("go", "Goの並行処理", "goroutineとchannelについて", "Go"),
+		entry("mongo", "MongoDBの設定", "レプリカセットを**構築**する", "db"),
+		entry("kana", "カタカナの記事", "ＡＢＣ全角英数", "memo"),
+		entry("mixed", "日記", "京都と東京に行った。Go言語の話もした", "diary"),
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	setupTestSettings(t, "")
+	idx := newSearchIndex()
+	entries := testSearchEntries(time.Now())
+	if err := idx.ensure(func() ([]MongoEntries, error) { return entries, nil }); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		query string
+		want  []string
+	}{
+		{"title ranks before content", "go", []string{"/go", "/mongo", "/mixed"}},
+		{"japanese bigram", "並行", []string{"/go"}},
+		{"single rune", "京", []string{"/mixed"}},
+		// bigramは全て含まれるが連続していない
+		{"not contiguous", "東京都", nil},
+		{"all terms", "go 京都", []string{"/mixed"}},
+		{"katakana by hiragana", "かたかな", []string{"/kana"}},
+		{"fullwidth by halfwidth", "abc", []string{"/kana"}},
+		{"markdown is removed", "構築", []string{"/mongo"}},
+		{"tag", "diary", []string{"/mixed"}},
+		{"symbols only", "!?", nil},
+		{"no match", "python", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, v := range idx.Search(tt.query, 0) {
+				got = append(got, v.URI)
+			}
+			if !equalStrings(got, tt.want) {
+				t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchHighlight(t *testing.T) {
+	setupTestSettings(t, "")
+	idx := newSearchIndex()
+	entries := []MongoEntries{{EntryCode: "x", Title: "<b>Go</b> & GO", Content: "text", IsPublished: IsPublished}}
+	idx.ensure(func() ([]MongoEntries, error) { return entries, nil })
+	results := idx.Search("go", 0)
+	if len(results) != 1 {
+		t.Fatalf("results = %v", results)
+	}
+	// titleはescapeされ、一致部分(大文字小文字を問わない)のみmarkされる
+	title := string(results[0].Title)
+	if strings.Contains(title, "<b>") || strings.Count(title, "<mark>") != 2 {
+		t.Errorf("title = %s", title)
+	}
+}
+
+func TestSearchIndexInvalidate(t *testing.T) {
+	setupTestSettings(t, "")
+	idx := newSearchIndex()
+	entries := testSearchEntries(time.Now())
+	loads := 0
+	load := func() ([]MongoEntries, error) {
+		loads++
+		return entries, nil
+	}
+	idx.ensure(load)
+	idx.ensure(load)
+	if loads != 1 {
+		t.Fatalf("loads = %d, want 1", loads)
+	}
+	entries = entries[:1]
+	idx.Invalidate()
+	idx.ensure(load)
+	if loads != 2 {
+		t.Fatalf("loads after Invalidate = %d, want 2", loads)
+	}
+	if got := idx.Search("京都", 0); len(got) != 0 {
+		t.Errorf("removed entry is found: %v", got)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import "time"
+
+// server - holds dependencies shared by actions
+type server struct {
+	entries   EntryRepository
+	users     UserRepository
+	revisions RevisionRepository
+	tags      TagRepository
+	// server-side sessions (nil = cookie store)
+	sessions SessionRepository
+	// backoff/lockout of backend logins
+	loginLimiter *loginLimiter
+	// cache entry (key = entryCode)
+	cacheEntry *Cache
+	// cache entries for page (key = page)
+	cachePage *Cache
+	// cache titleList for tag page (key = tagName/page)
+	cacheTitleList *Cache
+	// cache tags (key = cacheKeyTagsAll, cacheKeyTagMetas)
+	cacheTags *Cache
+	// cache feeds and sitemaps (key = format:tagName, sitemap:num)
+	cacheFeed *Cache
+	// cache archives (key = cacheKeyArchivesAll, year, year-month)
+	cacheArchive *Cache
+	// n-gram index of published entries for search
+	searchIndex *SearchIndex
+	// notify entry changes to publish scheduler
+	rescheduleCh chan struct{}
+	startedAt    time.Time
+	// 1 = graceful shutdown started (atomic)
+	shuttingDown int32
+}
+
+func newServer(entries EntryRepository, users UserRepository, revisions RevisionRepository, tags TagRepository) *server {
+	return &server{
+		entries:        entries,
+		users:          users,
+		revisions:      revisions,
+		tags:           tags,
+		cacheEntry:     newCache("entry", settings.CacheSize, settings.CacheTTL),
+		cachePage:      newCache("page", settings.CacheSize, settings.CacheTTL),
+		cacheTitleList: newCache("titleList", settings.CacheSize, settings.CacheTTL),
+		cacheTags:      newCache("tags", 2, settings.CacheTTL),
+		cacheFeed:      newCache("feed", settings.CacheSize, settings.CacheTTL),
+		cacheArchive:   newCache("archive", settings.CacheSize, settings.CacheTTL),
+		loginLimiter:   newLoginLimiter(settings, newMemoryLoginAttemptStore(settings.LoginHistorySize)),
+		searchIndex:    newSearchIndex(),
+		rescheduleCh:   make(chan struct{}, 1),
+		startedAt:      time.Now(),
+	}
+}
+
+// hit/miss counters of all caches
+func (s *server) cacheStats() []CacheStats {
+	return []CacheStats{
+		s.cacheEntry.Stats(),
+		s.cachePage.Stats(),
+		s.cacheTitleList.Stats(),
+		s.cacheTags.Stats(),
+		s.cacheFeed.Stats(),
+		s.cacheArchive.Stats(),
+	}
+}
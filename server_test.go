@@ -0,0 +1,211 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// settings.ini for tests (memory driver, cookie session)
+const testSettingsINI = `[app]
+HttpdPort = :0
+[site]
+BlogURL = https://example.com
+RootPath = /
+TimeZone = UTC
+BackendURI = backend/
+PagePerView = 2
+SessionName = _session
+[session]
+AuthKeys = ARLw014vZuKUnZAiwl9I26bTWi6vemkF+4Ko1eCOb5mSvH2Ozsfo0C7tjgWdJBbH1XmwNPyZ3mN9ucI9Wp+unw==
+EncryptionKeys = hQhyT3dccAdlRYXjz/YWqOjgfhzETJlrJK958pAWs1A=
+[db]
+Driver = memory
+DBPath = unused.json
+`
+
+// load testSettingsINI with extra lines appended ([section] key = value)
+func setupTestSettings(t *testing.T, extra string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "settings.ini")
+	if err := os.WriteFile(path, []byte(testSettingsINI+extra), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := initializeData(path); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// server and router on memoryRepository
+func newTestServer(t *testing.T, repo *memoryRepository) (*server, *echo.Echo) {
+	t.Helper()
+	return newTestServerWithSettings(t, repo, "")
+}
+
+// newTestServer with extra settings (see setupTestSettings)
+func newTestServerWithSettings(t *testing.T, repo *memoryRepository, extra string) (*server, *echo.Echo) {
+	t.Helper()
+	setupTestSettings(t, extra)
+	s := newServer(repo, repo, repo, repo)
+	sessionStore, sessionRepo, err := newSessionStore(settings, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.sessions = sessionRepo
+	return s, s.newRouter(sessionStore)
+}
+
+// published entries e1 (oldest) .. eN (newest), one day apart
+func testEntries(n int, now time.Time) []MongoEntries {
+	var entries []MongoEntries
+	for i := 1; i <= n; i++ {
+		code := "e" + string(rune('0'+i))
+		entries = append(entries, MongoEntries{
+			ID:          primitive.NewObjectID(),
+			EntryID:     int32(i),
+			EntryCode:   code,
+			PublishDate: now.AddDate(0, 0, i-n-1),
+			Title:       "title " + code,
+			Content:     "content of " + code,
+			Tag:         []string{"go"},
+			IsPublished: IsPublished,
+		})
+	}
+	return entries
+}
+
+// testClient - sends requests to the router with cookies of the previous responses
+type testClient struct {
+	e       *echo.Echo
+	cookies map[string]*http.Cookie
+}
+
+func newTestClient(e *echo.Echo) *testClient {
+	return &testClient{e: e, cookies: make(map[string]*http.Cookie)}
+}
+
+func (tc *testClient) do(req *http.Request) *httptest.ResponseRecorder {
+	for _, v := range tc.cookies {
+		req.AddCookie(v)
+	}
+	rec := httptest.NewRecorder()
+	tc.e.ServeHTTP(rec, req)
+	for _, v := range rec.Result().Cookies() {
+		if v.MaxAge < 0 {
+			delete(tc.cookies, v.Name)
+		} else {
+			tc.cookies[v.Name] = v
+		}
+	}
+	return rec
+}
+
+func (tc *testClient) get(path string) *httptest.ResponseRecorder {
+	return tc.do(httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+func TestPublicActions(t *testing.T) {
+	now := time.Now()
+	entries := testEntries(3, now)
+	// 非公開と予約投稿
+	entries = append(entries,
+		MongoEntries{ID: primitive.NewObjectID(), EntryID: 10, EntryCode: "draft", PublishDate: now.AddDate(0, 0, -1), Title: "draft", IsPublished: 0},
+		MongoEntries{ID: primitive.NewObjectID(), EntryID: 11, EntryCode: "scheduled", PublishDate: now.Add(time.Hour), Title: "scheduled", IsPublished: IsPublished},
+	)
+	_, e := newTestServer(t, newMemoryRepository(entries, nil))
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		contains []string
+		excludes []string
+	}{
+		{"index shows newest entries", "/", http.StatusOK, []string{"title e3", "title e2"}, []string{"title e1", "draft", "scheduled"}},
+		{"second page", "/page/1", http.StatusOK, []string{"title e1"}, []string{"title e3"}},
+		{"page out of range", "/page/5", http.StatusNotFound, nil, nil},
+		{"page not a number", "/page/x", http.StatusBadRequest, nil, nil},
+		{"negative page", "/page/-1", http.StatusBadRequest, nil, nil},
+		{"entry", "/e2", http.StatusOK, []string{"title e2", "content of e2"}, nil},
+		{"unknown entry", "/nothing", http.StatusNotFound, nil, nil},
+		{"unpublished entry", "/draft", http.StatusNotFound, nil, nil},
+		{"scheduled entry", "/scheduled", http.StatusNotFound, nil, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := newTestClient(e).get(tt.path)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			body := rec.Body.String()
+			for _, v := range tt.contains {
+				if !strings.Contains(body, v) {
+					t.Errorf("body does not contain %q", v)
+				}
+			}
+			for _, v := range tt.excludes {
+				if strings.Contains(body, v) {
+					t.Errorf("body contains %q", v)
+				}
+			}
+		})
+	}
+}
+
+func TestBackendRequiresLogin(t *testing.T) {
+	_, e := newTestServer(t, newMemoryRepository(nil, nil))
+	tests := []struct {
+		name   string
+		path   string
+		status int
+	}{
+		{"manager redirects to login", "/backend/manager/", http.StatusFound},
+		{"api get", "/backend/manager/api/getAllEntries", http.StatusUnauthorized},
+		{"login form", "/backend/", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := newTestClient(e).get(tt.path); rec.Code != tt.status {
+				t.Errorf("status = %d, want %d", rec.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestIPExtractor(t *testing.T) {
+	tests := []struct {
+		name       string
+		proxies    string
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{"no proxies ignores header", "", "10.0.0.1:1234", "1.2.3.4", "10.0.0.1"},
+		{"trusted proxy", "10.0.0.1", "10.0.0.1:1234", "1.2.3.4", "1.2.3.4"},
+		// private networkでも設定に無ければ信頼しない
+		{"untrusted proxy", "10.0.0.1", "10.0.0.2:1234", "1.2.3.4", "10.0.0.2"},
+		{"trusted chain", "10.0.0.1, 192.168.0.0/16", "10.0.0.1:1234", "1.2.3.4, 192.168.1.5", "1.2.3.4"},
+		{"spoofed first address", "10.0.0.1", "10.0.0.1:1234", "6.6.6.6, 1.2.3.4", "1.2.3.4"},
+		{"ipv6", "::1", "[::1]:1234", "2001:db8::1", "2001:db8::1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := loadSettings(writeTestSettings(t, testSettingsINI+"[app]\nTrustedProxies = "+tt.proxies+"\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set(echo.HeaderXForwardedFor, tt.xff)
+			if got := newIPExtractor(s)(req); got != tt.want {
+				t.Errorf("ip = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
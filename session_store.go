@@ -0,0 +1,453 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo-contrib/session"
+	"github.com/labstack/echo/v4"
+)
+
+// [session] Store
+const (
+	SessionStoreCookie = "cookie"
+	SessionStoreDB     = "db"
+	SessionStoreFile   = "file"
+)
+
+const (
+	sessionCleanupInterval = time.Hour
+	sessionIDBytes         = 32
+)
+
+var errSessionStoreCookie = errors.New("sessions are stored in cookies ([session] Store = cookie)")
+
+// key pairs (auth, encryption) from [session] AuthKeys/EncryptionKeys
+// 先頭のkeyで署名/暗号化し、残りのkeyはrotation前のcookieの検証のみに使う
+func sessionKeyPairs(s Settings) [][]byte {
+	authKeys := s.SessionAuthKeys
+	if len(authKeys) == 0 {
+		// 開発環境のみ (本番ではvalidateSettingsでエラーになる). 再起動でsessionは無効になる
+		appLog.Warn("[session] AuthKeys is empty, using a random key")
+		authKeys = [][]byte{securecookie.GenerateRandomKey(64)}
+	}
+	var pairs [][]byte
+	for i, v := range authKeys {
+		var encryptionKey []byte
+		if i < len(s.SessionEncryptionKeys) {
+			encryptionKey = s.SessionEncryptionKeys[i]
+		}
+		pairs = append(pairs, v, encryptionKey)
+	}
+	return pairs
+}
+
+// session store selected by [session] Store
+// dbの場合は[db] Driverのrepositoryに保存する. cookie以外はSessionRepositoryも返す (list/revoke用)
+func newSessionStore(s Settings, repo Repository) (sessions.Store, SessionRepository, error) {
+	pairs := sessionKeyPairs(s)
+	codecs := securecookie.CodecsFromPairs(pairs...)
+	switch s.SessionStore {
+	case SessionStoreDB:
+		return newServerSessionStore(codecs, repo, s), repo, nil
+	case SessionStoreFile:
+		fileRepo, err := newFileSessionRepository(s.SessionDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		return newServerSessionStore(codecs, fileRepo, s), fileRepo, nil
+	}
+	return sessions.NewCookieStore(pairs...), nil, nil
+}
+
+// serverSessionStore - sessions.Store which keeps values in SessionRepository and only the session id in the cookie
+type serverSessionStore struct {
+	codecs []securecookie.Codec
+	repo   SessionRepository
+	// [session] IdleTimeout, AbsoluteTimeout
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+	// c.RealIP()と同じip ([app] TrustedProxies)
+	remoteIP echo.IPExtractor
+}
+
+func newServerSessionStore(codecs []securecookie.Codec, repo SessionRepository, s Settings) *serverSessionStore {
+	// 値はcookieに入らないので長さの制限は不要
+	for _, v := range codecs {
+		if c, ok := v.(*securecookie.SecureCookie); ok {
+			c.MaxLength(0)
+		}
+	}
+	return &serverSessionStore{codecs: codecs, repo: repo, idleTimeout: s.SessionIdleTimeout, absoluteTimeout: s.SessionAbsoluteTimeout, remoteIP: newIPExtractor(s)}
+}
+
+// expiry of the saved session (最終アクセスからidleTimeout, ログイン済みの場合はログインからabsoluteTimeoutまで)
+func (st *serverSessionStore) expiresAt(ses *sessions.Session, now time.Time) time.Time {
+	expires := now.Add(st.idleTimeout)
+	if issuedAt, ok := ses.Values[IssuedAtSessionKey].(int64); ok {
+		if limit := time.Unix(issuedAt, 0).Add(st.absoluteTimeout); limit.Before(expires) {
+			return limit
+		}
+	}
+	return expires
+}
+
+// Get returns a cached session of the request
+func (st *serverSessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(st, name)
+}
+
+// New loads a session by the id in the cookie (revokeされた場合は新しいsessionになる)
+func (st *serverSessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	ses := sessions.NewSession(st, name)
+	ses.Options = &sessions.Options{Path: "/"}
+	ses.IsNew = true
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ses, nil
+	}
+	var id string
+	if err := securecookie.DecodeMulti(name, cookie.Value, &id, st.codecs...); err != nil {
+		return ses, err
+	}
+	doc, err := st.repo.FindSession(id, time.Now())
+	if err == errNotFound {
+		return ses, nil
+	}
+	if err != nil {
+		return ses, err
+	}
+	if err := securecookie.DecodeMulti(name, doc.Data, &ses.Values, st.codecs...); err != nil {
+		return ses, err
+	}
+	ses.ID = id
+	ses.IsNew = false
+	return ses, nil
+}
+
+// Save stores values and sets the cookie (MaxAge < 0 deletes the session)
+func (st *serverSessionStore) Save(r *http.Request, w http.ResponseWriter, ses *sessions.Session) error {
+	if ses.Options.MaxAge < 0 {
+		if ses.ID != "" {
+			if err := st.repo.DeleteSession(ses.ID); err != nil && err != errNotFound {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(ses.Name(), "", ses.Options))
+		return nil
+	}
+	now := time.Now()
+	if ses.ID == "" {
+		b := make([]byte, sessionIDBytes)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		ses.ID = hex.EncodeToString(b)
+	}
+	data, err := securecookie.EncodeMulti(ses.Name(), ses.Values, st.codecs...)
+	if err != nil {
+		return err
+	}
+	userID, _ := ses.Values[UserIDSessionKey].(int32)
+	doc := MongoSessions{
+		ID:        ses.ID,
+		UserID:    userID,
+		Data:      data,
+		RemoteIP:  st.remoteIP(r),
+		UserAgent: r.UserAgent(),
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: st.expiresAt(ses, now),
+	}
+	if err := st.repo.SaveSession(doc); err != nil {
+		return err
+	}
+	encoded, err := securecookie.EncodeMulti(ses.Name(), ses.ID, st.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(ses.Name(), encoded, ses.Options))
+	return nil
+}
+
+// delete expired server-side sessions periodically until ctx is done
+func runSessionCleanup(ctx context.Context, repo SessionRepository) {
+	ticker := time.NewTicker(sessionCleanupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n, err := repo.DeleteExpiredSessions(time.Now()); err != nil {
+				appLog.Error("session cleanup error", "error", err)
+			} else if n > 0 {
+				appLog.Info("deleted expired sessions", "sessions", n)
+			}
+		}
+	}
+}
+
+// fileSessionRepository - SessionRepository which stores a json file per session in a directory
+type fileSessionRepository struct {
+	mu  sync.Mutex
+	dir string
+}
+
+func newFileSessionRepository(dir string) (*fileSessionRepository, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &fileSessionRepository{dir: dir}, nil
+}
+
+// session id is hex (cookieの値は署名を検証してから使うのでpathにはならないが念のため確認する)
+func (r *fileSessionRepository) path(id string) (string, error) {
+	if _, err := hex.DecodeString(id); err != nil || id == "" {
+		return "", errNotFound
+	}
+	return filepath.Join(r.dir, "session_"+id+".json"), nil
+}
+
+func (r *fileSessionRepository) read(path string) (MongoSessions, error) {
+	var result MongoSessions
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return result, errNotFound
+	}
+	if err != nil {
+		return result, err
+	}
+	// IDとDataはapiのjsonに出さないので別のstructで保存する
+	var file fileSession
+	if err := json.Unmarshal(b, &file); err != nil {
+		return result, err
+	}
+	return file.toSession(), nil
+}
+
+// FindSession returns a session which is not expired by id
+func (r *fileSessionRepository) FindSession(id string, now time.Time) (MongoSessions, error) {
+	path, err := r.path(id)
+	if err != nil {
+		return MongoSessions{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result, err := r.read(path)
+	if err != nil {
+		return result, err
+	}
+	if !result.ExpiresAt.After(now) {
+		return MongoSessions{}, errNotFound
+	}
+	return result, nil
+}
+
+func (r *fileSessionRepository) all() ([]MongoSessions, error) {
+	paths, err := filepath.Glob(filepath.Join(r.dir, "session_*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var results []MongoSessions
+	for _, path := range paths {
+		result, err := r.read(path)
+		if err == errNotFound {
+			continue
+		}
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// FindSessions returns sessions which are not expired ordered by updatedAt desc
+func (r *fileSessionRepository) FindSessions(now time.Time) ([]MongoSessions, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all, err := r.all()
+	if err != nil {
+		return nil, err
+	}
+	var results []MongoSessions
+	for _, v := range all {
+		if v.ExpiresAt.After(now) {
+			results = append(results, v)
+		}
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].UpdatedAt.After(results[j].UpdatedAt)
+	})
+	return results, nil
+}
+
+// SaveSession writes the session file (createdAt of an existing session is kept)
+func (r *fileSessionRepository) SaveSession(ses MongoSessions) error {
+	path, err := r.path(ses.ID)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if v, err := r.read(path); err == nil {
+		ses.CreatedAt = v.CreatedAt
+	}
+	b, err := json.Marshal(newFileSession(ses))
+	if err != nil {
+		return err
+	}
+	// 書き込み途中のファイルを読まないようにrenameで置き換える
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// DeleteSession deletes a session file by id
+func (r *fileSessionRepository) DeleteSession(id string) error {
+	path, err := r.path(id)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return errNotFound
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteExpiredSessions deletes session files which expired
+func (r *fileSessionRepository) DeleteExpiredSessions(now time.Time) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	all, err := r.all()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	for _, v := range all {
+		if v.ExpiresAt.After(now) {
+			continue
+		}
+		if path, err := r.path(v.ID); err == nil && os.Remove(path) == nil {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// fileSession - file format of fileSessionRepository
+type fileSession struct {
+	ID        string    `json:"id"`
+	UserID    int32     `json:"userId"`
+	Data      string    `json:"data"`
+	RemoteIP  string    `json:"remoteIp"`
+	UserAgent string    `json:"userAgent"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func newFileSession(s MongoSessions) fileSession {
+	return fileSession(s)
+}
+
+func (f fileSession) toSession() MongoSessions {
+	return MongoSessions(f)
+}
+
+// SessionItem - session for manager api (idはsession idのhash)
+type SessionItem struct {
+	ID string `json:"id"`
+	MongoSessions
+	Current bool `json:"current"`
+}
+
+// public id of a session (session id自体はapiに出さない)
+func sessionHandle(id string) string {
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:16])
+}
+
+// logged-in sessions of the loggedin user (他のuserのsessionは返さない)
+func (s *server) getSessionList(c echo.Context) ([]SessionItem, error) {
+	if s.sessions == nil {
+		return nil, errSessionStoreCookie
+	}
+	list, err := s.sessions.FindSessions(time.Now())
+	if err != nil {
+		return nil, err
+	}
+	currentID := ""
+	if ses, err := session.Get(settings.SessionName, c); err == nil {
+		currentID = ses.ID
+	}
+	userID := loggedinUserID(c)
+	items := []SessionItem{}
+	for _, v := range list {
+		// anonymous sessions only for csrf token are also excluded
+		if v.UserID == 0 || v.UserID != userID {
+			continue
+		}
+		items = append(items, SessionItem{ID: sessionHandle(v.ID), MongoSessions: v, Current: v.ID == currentID})
+	}
+	return items, nil
+}
+
+// delete server-side sessions of the user except exceptID (password変更, 全sessionのlogout)
+// cookie storeの場合はsession generationの確認でのみ無効になる
+func (s *server) deleteUserSessions(userID int32, exceptID string) error {
+	if s.sessions == nil {
+		return nil
+	}
+	list, err := s.sessions.FindSessions(time.Now())
+	if err != nil {
+		return err
+	}
+	for _, v := range list {
+		if v.UserID != userID || v.ID == exceptID {
+			continue
+		}
+		if err := s.sessions.DeleteSession(v.ID); err != nil && err != errNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// revoke a session of the loggedin user by public id (他のuserのsessionはerrNotFound)
+func (s *server) revokeSession(c echo.Context, handle string) error {
+	if s.sessions == nil {
+		return errSessionStoreCookie
+	}
+	list, err := s.sessions.FindSessions(time.Now())
+	if err != nil {
+		return err
+	}
+	userID := loggedinUserID(c)
+	for _, v := range list {
+		if v.UserID != 0 && v.UserID == userID && sessionHandle(v.ID) == handle {
+			return s.sessions.DeleteSession(v.ID)
+		}
+	}
+	return errNotFound
+}
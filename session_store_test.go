@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// 他のuserのsessionは一覧に出さず、revokeもできない
+func TestSessionsOfOtherUsers(t *testing.T) {
+	repo := newMemoryRepository(nil, []MongoUsers{testNamedUser(t, 1, "admin"), testNamedUser(t, 2, "guest")})
+	_, e := newTestServerWithSettings(t, repo, "[session]\nStore = db\n")
+	admin, adminToken := loginTestClientAs(t, e, "admin")
+	guest, guestToken := loginTestClientAs(t, e, "guest")
+
+	sessions := func(tc *testClient) []SessionItem {
+		t.Helper()
+		var res struct {
+			Sessions []SessionItem `json:"sessions"`
+			Error    string        `json:"error"`
+		}
+		rec := tc.get("/backend/manager/api/getSessions")
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil || res.Error != "" {
+			t.Fatalf("getSessions: %d %s", rec.Code, rec.Body.String())
+		}
+		return res.Sessions
+	}
+	revoke := func(tc *testClient, token *string, id string) string {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/backend/manager/api/revokeSession", strings.NewReader(`{"id":"`+id+`"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(HeaderXCSRFToken, *token)
+		rec := tc.do(req)
+		*token = rec.Header().Get(HeaderXCSRFToken)
+		var res struct {
+			Error string `json:"error"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatalf("revokeSession: %d %s", rec.Code, rec.Body.String())
+		}
+		return res.Error
+	}
+
+	tests := []struct {
+		name   string
+		tc     *testClient
+		userID int32
+	}{
+		{"admin", admin, 1},
+		{"guest", guest, 2},
+	}
+	for _, tt := range tests {
+		list := sessions(tt.tc)
+		if len(list) != 1 {
+			t.Fatalf("%s: sessions = %d, want 1", tt.name, len(list))
+		}
+		if list[0].UserID != tt.userID || !list[0].Current {
+			t.Errorf("%s: session of user %d, current %v", tt.name, list[0].UserID, list[0].Current)
+		}
+	}
+
+	adminSession := sessions(admin)[0].ID
+	if err := revoke(guest, &guestToken, adminSession); err != errNotFound.Error() {
+		t.Errorf("guest revokes admin session: error = %q", err)
+	}
+	if len(sessions(admin)) != 1 {
+		t.Error("admin session is revoked by guest")
+	}
+	if err := revoke(admin, &adminToken, adminSession); err != "" {
+		t.Errorf("admin revokes own session: error = %q", err)
+	}
+	if rec := admin.get("/backend/manager/api/getSessions"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked session: status = %d", rec.Code)
+	}
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// max urls and uncompressed bytes per sitemap file (sitemaps.org protocol)
+const (
+	SitemapMaxURLs  = 50000
+	SitemapMaxBytes = 50 * 1024 * 1024
+)
+
+const ContentTypeXML = "application/xml; charset=utf-8"
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 sitemapindex"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// <url> and <sitemap>
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+func sitemapLastMod(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// later of updatedAt and publishDate
+func entryLastMod(entry MongoEntries) time.Time {
+	if entry.UpdatedAt.After(entry.PublishDate) {
+		return entry.UpdatedAt
+	}
+	return entry.PublishDate
+}
+
+// lastmod of each page (lastMods are ordered same as the pages, at least 1 page)
+func pageLastMods(lastMods []time.Time, perPage int) []time.Time {
+	if perPage < 1 {
+		perPage = 1
+	}
+	var pages []time.Time
+	for page := 0; page == 0 || page*perPage < len(lastMods); page++ {
+		var lastMod time.Time
+		end := (page + 1) * perPage
+		if end > len(lastMods) {
+			end = len(lastMods)
+		}
+		for _, t := range lastMods[page*perPage : end] {
+			if t.After(lastMod) {
+				lastMod = t
+			}
+		}
+		pages = append(pages, lastMod)
+	}
+	return pages
+}
+
+// all urls for sitemap: paginated index, entries and paginated tag pages
+func (s *server) getSitemapURLs() ([]sitemapURL, error) {
+	entries, err := s.entries.FindPublished(time.Now(), 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	var urls []sitemapURL
+	var entryLastMods []time.Time
+	// lastmod of entries of each tag (publishDate desc = tag pageの順)
+	tagLastMods := make(map[string][]time.Time)
+	var tagNames []string
+	for _, v := range entries {
+		lastMod := entryLastMod(v)
+		entryLastMods = append(entryLastMods, lastMod)
+		for _, t := range v.Tag {
+			if _, ok := tagLastMods[t]; !ok {
+				tagNames = append(tagNames, t)
+			}
+			tagLastMods[t] = append(tagLastMods[t], lastMod)
+		}
+	}
+	// index, page/1...
+	for page, lastMod := range pageLastMods(entryLastMods, settings.PagePerView) {
+		uri := settings.RootPath
+		if page > 0 {
+			uri = paginatorPrefixURI + strconv.Itoa(page)
+		}
+		urls = append(urls, sitemapURL{Loc: absoluteURL(uri), LastMod: sitemapLastMod(lastMod)})
+	}
+	// entries
+	for i, v := range entries {
+		urls = append(urls, sitemapURL{Loc: absoluteURL(settings.RootPath + v.EntryCode), LastMod: sitemapLastMod(entryLastMods[i])})
+	}
+	// tag/:tagName, tag/:tagName/page/1...
+	for _, t := range tagNames {
+		for page, lastMod := range pageLastMods(tagLastMods[t], settings.TagPagePerView) {
+			urls = append(urls, sitemapURL{Loc: absoluteURL(s.tagPageURI(t, page)), LastMod: sitemapLastMod(lastMod)})
+		}
+	}
+	return urls, nil
+}
+
+// bytes of <url>...</url> in the sitemap
+func sitemapURLSize(u sitemapURL) int {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(u.Loc))
+	size := len("<url><loc></loc></url>") + b.Len()
+	if u.LastMod != "" {
+		size += len("<lastmod></lastmod>") + len(u.LastMod)
+	}
+	return size
+}
+
+// split urls into sitemap files of at most maxURLs urls and maxBytes bytes (uncompressed)
+func splitSitemapURLs(urls []sitemapURL, maxURLs, maxBytes int) [][]sitemapURL {
+	empty, _ := xml.Marshal(sitemapURLSet{})
+	overhead := len(xml.Header) + len(empty)
+	var files [][]sitemapURL
+	start, size := 0, overhead
+	for i, u := range urls {
+		n := sitemapURLSize(u)
+		if i > start && (i-start >= maxURLs || size+n > maxBytes) {
+			files = append(files, urls[start:i])
+			start, size = i, overhead
+		}
+		size += n
+	}
+	if start < len(urls) || len(files) == 0 {
+		files = append(files, urls[start:])
+	}
+	return files
+}
+
+// sitemap.xml (num == 0) or sitemap-num.xml (cached)
+// urlの件数かsizeが上限を超える場合はsitemap.xmlをsitemap indexにして、sitemap-1.xml...に分割する
+func (s *server) getSitemap(num int) ([]byte, error) {
+	key := "sitemap:" + strconv.Itoa(num)
+	generation := s.cacheFeed.Generation()
+	if val, ok := s.cacheFeed.Get(key); ok {
+		return val.([]byte), nil
+	}
+	urls, err := s.getSitemapURLs()
+	if err != nil {
+		return nil, err
+	}
+	files := splitSitemapURLs(urls, SitemapMaxURLs, SitemapMaxBytes)
+	var v interface{}
+	switch {
+	case num == 0 && len(files) == 1:
+		v = sitemapURLSet{URLs: files[0]}
+	case num == 0:
+		index := sitemapIndex{}
+		for i := 1; i <= len(files); i++ {
+			index.Sitemaps = append(index.Sitemaps, sitemapURL{Loc: absoluteURL(settings.RootPath + "sitemap-" + strconv.Itoa(i) + ".xml")})
+		}
+		v = index
+	case len(files) > 1 && num <= len(files):
+		v = sitemapURLSet{URLs: files[num-1]}
+	default:
+		return nil, errNotFound
+	}
+	b, err := xml.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	b = append([]byte(xml.Header), b...)
+	s.cacheFeed.Set(key, b, generation)
+	return b, nil
+}
+
+// sitemap action (sitemap.xml, sitemap-:num.xml)
+func (s *server) sitemapAction(c echo.Context) error {
+	num := 0
+	if param := c.Param("num"); param != "" {
+		n, err := strconv.Atoi(strings.TrimSuffix(param, ".xml"))
+		if err != nil || n < 1 || !strings.HasSuffix(param, ".xml") {
+			return echo.NewHTTPError(http.StatusNotFound)
+		}
+		num = n
+	}
+	b, err := s.getSitemap(num)
+	if err == errNotFound {
+		return echo.NewHTTPError(http.StatusNotFound)
+	}
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError).SetInternal(err)
+	}
+	return c.Blob(http.StatusOK, ContentTypeXML, b)
+}
+
+// robots action (/robots.txt)
+// RobotsFileが指定されている場合はその内容、無い場合はbackendのみDisallowにする。末尾にSitemapを追加する
+func robotsAction(c echo.Context) error {
+	rules := "User-agent: *\nDisallow: " + settings.RootPath + settings.BackendURI + "\n"
+	if settings.RobotsFile != "" {
+		b, err := os.ReadFile(settings.RobotsFile)
+		if err != nil {
+			return c.String(http.StatusNotFound, "")
+		}
+		rules = strings.TrimRight(string(b), "\n") + "\n"
+	}
+	return c.String(http.StatusOK, rules+"\nSitemap: "+absoluteURL(settings.RootPath+"sitemap.xml")+"\n")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/xml"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSplitSitemapURLs(t *testing.T) {
+	var urls []sitemapURL
+	for i := 0; i < 10; i++ {
+		urls = append(urls, sitemapURL{Loc: "https://example.com/entry-" + strconv.Itoa(i), LastMod: "2021-01-02T03:04:05Z"})
+	}
+	one, _ := xml.Marshal(sitemapURLSet{URLs: urls[:1]})
+	// 1件のfileのsize
+	oneFile := len(xml.Header) + len(one)
+	tests := []struct {
+		name     string
+		urls     []sitemapURL
+		maxURLs  int
+		maxBytes int
+		want     []int
+	}{
+		{"empty", nil, 3, SitemapMaxBytes, []int{0}},
+		{"within limits", urls, 10, SitemapMaxBytes, []int{10}},
+		{"by count", urls, 4, SitemapMaxBytes, []int{4, 4, 2}},
+		{"by size", urls, 10, oneFile + sitemapURLSize(urls[0])*2, []int{3, 3, 3, 1}},
+		{"url larger than the limit", urls[:2], 10, 1, []int{1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := splitSitemapURLs(tt.urls, tt.maxURLs, tt.maxBytes)
+			var got []int
+			for _, v := range files {
+				got = append(got, len(v))
+				if b, _ := xml.Marshal(sitemapURLSet{URLs: v}); len(v) > 1 && len(xml.Header)+len(b) > tt.maxBytes {
+					t.Errorf("file of %d urls is %d bytes", len(v), len(xml.Header)+len(b))
+				}
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("files = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("files = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSitemapTagPages(t *testing.T) {
+	// PagePerView = 2, 5 entries of tag go -> tag/go, tag/go/page/1, tag/go/page/2
+	_, e := newTestServer(t, newMemoryRepository(testEntries(5, time.Now()), nil))
+	rec := newTestClient(e).get("/sitemap.xml")
+	if rec.Code != 200 {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	body := rec.Body.String()
+	for _, v := range []string{"/tag/go<", "/tag/go/page/1<", "/tag/go/page/2<", "/page/2<"} {
+		if !strings.Contains(body, v) {
+			t.Errorf("sitemap does not contain %s", v)
+		}
+	}
+	if strings.Contains(body, "/tag/go/page/3<") {
+		t.Error("sitemap contains a tag page out of range")
+	}
+}
@@ -0,0 +1,686 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sqlite schema (MongoEntries/MongoUsers/MongoRevisions/MongoTags/MongoSessionsと同じ項目を持つ)
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS entries (
+	id           TEXT PRIMARY KEY,
+	entry_id     INTEGER NOT NULL,
+	entry_code   TEXT NOT NULL UNIQUE,
+	publish_date TEXT NOT NULL DEFAULT '',
+	title        TEXT NOT NULL DEFAULT '',
+	content      TEXT NOT NULL DEFAULT '',
+	is_published INTEGER NOT NULL DEFAULT 0,
+	author_id    INTEGER NOT NULL DEFAULT 0,
+	created_at   TEXT NOT NULL DEFAULT '',
+	updated_at   TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS entries_published ON entries (is_published, publish_date);
+CREATE TABLE IF NOT EXISTS entry_tags (
+	entry_id TEXT NOT NULL REFERENCES entries (id) ON DELETE CASCADE,
+	position INTEGER NOT NULL,
+	tag      TEXT NOT NULL,
+	PRIMARY KEY (entry_id, position)
+);
+CREATE INDEX IF NOT EXISTS entry_tags_tag ON entry_tags (tag);
+CREATE TABLE IF NOT EXISTS users (
+	id                 TEXT PRIMARY KEY,
+	user_id            INTEGER NOT NULL,
+	name               TEXT NOT NULL UNIQUE,
+	password           TEXT NOT NULL,
+	session_generation INTEGER NOT NULL DEFAULT 0,
+	totp_secret         TEXT NOT NULL DEFAULT '',
+	totp_pending_secret TEXT NOT NULL DEFAULT '',
+	totp_last_counter   INTEGER NOT NULL DEFAULT 0,
+	recovery_codes      TEXT NOT NULL DEFAULT '[]'
+);
+CREATE TABLE IF NOT EXISTS revisions (
+	id              TEXT PRIMARY KEY,
+	entry_object_id TEXT NOT NULL,
+	revision        INTEGER NOT NULL,
+	entry           TEXT NOT NULL,
+	saved_by        INTEGER NOT NULL DEFAULT 0,
+	saved_at        TEXT NOT NULL DEFAULT '',
+	UNIQUE (entry_object_id, revision)
+);
+CREATE TABLE IF NOT EXISTS tags (
+	id          TEXT PRIMARY KEY,
+	name        TEXT NOT NULL UNIQUE,
+	slug        TEXT NOT NULL DEFAULT '',
+	description TEXT NOT NULL DEFAULT '',
+	parent      TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS sessions (
+	id         TEXT PRIMARY KEY,
+	user_id    INTEGER NOT NULL DEFAULT 0,
+	data       TEXT NOT NULL,
+	remote_ip  TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	created_at TEXT NOT NULL DEFAULT '',
+	updated_at TEXT NOT NULL DEFAULT '',
+	expires_at TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS sessions_expires_at ON sessions (expires_at);
+`
+
+// columns added after the table was created (CREATE TABLE IF NOT EXISTSでは既存のfileに追加されない)
+var sqliteAddedColumns = []struct {
+	table, column, definition string
+}{
+	{"users", "session_generation", "INTEGER NOT NULL DEFAULT 0"},
+	{"users", "totp_secret", "TEXT NOT NULL DEFAULT ''"},
+	{"users", "totp_pending_secret", "TEXT NOT NULL DEFAULT ''"},
+	{"users", "totp_last_counter", "INTEGER NOT NULL DEFAULT 0"},
+	{"users", "recovery_codes", "TEXT NOT NULL DEFAULT '[]'"},
+}
+
+const sqliteUserColumns = "id, user_id, name, password, session_generation, totp_secret, totp_pending_secret, totp_last_counter, recovery_codes"
+
+const sqliteEntryColumns = "id, entry_id, entry_code, publish_date, title, content, is_published, author_id, created_at, updated_at"
+
+// datetime columns are stored as UTC text so that they can be compared as strings
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+func sqliteTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+func parseSqliteTime(value string) time.Time {
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation(sqliteTimeFormat, value, time.UTC)
+	if err != nil {
+		// 手動で登録された場合等
+		t, _ = parseDateTime(value)
+	}
+	return t
+}
+
+// sqliteRepository - Repository implementation for embedded SQLite
+type sqliteRepository struct {
+	db *sql.DB
+}
+
+// *sql.DB or *sql.Tx
+type sqliteQuerier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// open sqlite file and create schema on first start
+func newSqliteRepository(s Settings) (*sqliteRepository, error) {
+	// transactionは開始時に書き込みlockを取る (読み込み後に他の書き込みが入らないように)
+	db, err := sql.Open("sqlite3", "file:"+s.DBPath+"?_foreign_keys=on&_busy_timeout=5000&_txlock=immediate")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := addSqliteColumns(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteRepository{db: db}, nil
+}
+
+// add sqliteAddedColumns which are missing in the database file
+func addSqliteColumns(db *sql.DB) error {
+	for _, v := range sqliteAddedColumns {
+		var n int
+		err := db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", v.table, v.column).Scan(&n)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			continue
+		}
+		if _, err := db.Exec("ALTER TABLE " + v.table + " ADD COLUMN " + v.column + " " + v.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close closes the database file
+func (r *sqliteRepository) Close() error {
+	return r.db.Close()
+}
+
+func (r *sqliteRepository) Ping(ctx context.Context) error {
+	return r.db.PingContext(ctx)
+}
+
+// scan rows of sqliteEntryColumns and attach tags
+func (r *sqliteRepository) scanEntries(rows *sql.Rows) ([]MongoEntries, error) {
+	return scanSqliteEntries(r.db, rows)
+}
+
+// scan entries and attach tags with q (transaction内ではtxで読む)
+func scanSqliteEntries(q sqliteQuerier, rows *sql.Rows) ([]MongoEntries, error) {
+	var results []MongoEntries
+	defer rows.Close()
+	for rows.Next() {
+		var result MongoEntries
+		var id, publishDate, createdAt, updatedAt string
+		err := rows.Scan(&id, &result.EntryID, &result.EntryCode, &publishDate, &result.Title, &result.Content,
+			&result.IsPublished, &result.AuthorID, &createdAt, &updatedAt)
+		if err != nil {
+			return results, err
+		}
+		result.ID, _ = primitive.ObjectIDFromHex(id)
+		result.PublishDate = parseSqliteTime(publishDate)
+		result.CreatedAt = parseSqliteTime(createdAt)
+		result.UpdatedAt = parseSqliteTime(updatedAt)
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return results, err
+	}
+	return results, attachSqliteTags(q, results)
+}
+
+// load entry_tags for entries
+func attachSqliteTags(q sqliteQuerier, entries []MongoEntries) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	index := make(map[string]int, len(entries))
+	args := make([]interface{}, len(entries))
+	for i, v := range entries {
+		index[v.ID.Hex()] = i
+		args[i] = v.ID.Hex()
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(entries)), ",")
+	rows, err := q.Query("SELECT entry_id, tag FROM entry_tags WHERE entry_id IN ("+placeholders+") ORDER BY entry_id, position", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		if i, ok := index[id]; ok {
+			entries[i].Tag = append(entries[i].Tag, tag)
+		}
+	}
+	return rows.Err()
+}
+
+// FindPublished returns published entries ordered by publishDate desc
+func (r *sqliteRepository) FindPublished(now time.Time, offset, limit int) ([]MongoEntries, error) {
+	rows, err := r.db.Query("SELECT "+sqliteEntryColumns+" FROM entries WHERE is_published = ? AND publish_date <= ? ORDER BY publish_date DESC LIMIT ? OFFSET ?",
+		IsPublished, sqliteTime(now), sqliteLimit(limit), offset)
+	if err != nil {
+		return nil, err
+	}
+	return r.scanEntries(rows)
+}
+
+// FindPublishedByCode returns a published entry by entryCode
+func (r *sqliteRepository) FindPublishedByCode(entryCode string, now time.Time) (MongoEntries, error) {
+	rows, err := r.db.Query("SELECT "+sqliteEntryColumns+" FROM entries WHERE entry_code = ? AND is_published = ? AND publish_date <= ?",
+		entryCode, IsPublished, sqliteTime(now))
+	if err != nil {
+		return MongoEntries{}, err
+	}
+	results, err := r.scanEntries(rows)
+	if err != nil {
+		return MongoEntries{}, err
+	}
+	if len(results) == 0 {
+		return MongoEntries{}, errNotFound
+	}
+	return results[0], nil
+}
+
+// FindPublishedByTag returns published entries which have the tag
+func (r *sqliteRepository) FindPublishedByTag(tagName string, now time.Time, offset, limit int) ([]MongoEntries, error) {
+	rows, err := r.db.Query("SELECT "+sqliteEntryColumns+" FROM entries WHERE is_published = ? AND publish_date <= ? AND id IN (SELECT entry_id FROM entry_tags WHERE tag = ?) ORDER BY publish_date DESC LIMIT ? OFFSET ?",
+		IsPublished, sqliteTime(now), tagName, sqliteLimit(limit), offset)
+	if err != nil {
+		return nil, err
+	}
+	return r.scanEntries(rows)
+}
+
+// FindPublishedBetween returns published entries in from <= publishDate < to
+func (r *sqliteRepository) FindPublishedBetween(from, to, now time.Time) ([]MongoEntries, error) {
+	rows, err := r.db.Query("SELECT "+sqliteEntryColumns+" FROM entries WHERE is_published = ? AND publish_date <= ? AND publish_date >= ? AND publish_date < ? ORDER BY publish_date DESC",
+		IsPublished, sqliteTime(now), sqliteTime(from), sqliteTime(to))
+	if err != nil {
+		return nil, err
+	}
+	return r.scanEntries(rows)
+}
+
+// FindScheduled returns published entries whose publishDate is after the time
+func (r *sqliteRepository) FindScheduled(after time.Time, limit int) ([]MongoEntries, error) {
+	rows, err := r.db.Query("SELECT "+sqliteEntryColumns+" FROM entries WHERE is_published = ? AND publish_date > ? ORDER BY publish_date ASC LIMIT ?",
+		IsPublished, sqliteTime(after), sqliteLimit(limit))
+	if err != nil {
+		return nil, err
+	}
+	return r.scanEntries(rows)
+}
+
+// limit 0 = no limit (sqliteでは-1)
+func sqliteLimit(limit int) int {
+	if limit <= 0 {
+		return -1
+	}
+	return limit
+}
+
+// FindAll returns all entries ordered by publishDate desc
+func (r *sqliteRepository) FindAll() ([]MongoEntries, error) {
+	rows, err := r.db.Query("SELECT " + sqliteEntryColumns + " FROM entries ORDER BY publish_date DESC")
+	if err != nil {
+		return nil, err
+	}
+	return r.scanEntries(rows)
+}
+
+// FindUserByName returns a backend user by name
+func (r *sqliteRepository) FindUserByName(name string) (MongoUsers, error) {
+	return r.findUser("name = ?", name)
+}
+
+// FindUserByID returns a backend user by userId
+func (r *sqliteRepository) FindUserByID(userID int32) (MongoUsers, error) {
+	return r.findUser("user_id = ?", userID)
+}
+
+func (r *sqliteRepository) findUser(where string, args ...interface{}) (MongoUsers, error) {
+	var user MongoUsers
+	var id, recoveryCodes string
+	err := r.db.QueryRow("SELECT "+sqliteUserColumns+" FROM users WHERE "+where, args...).
+		Scan(&id, &user.UserID, &user.Name, &user.PassWord, &user.SessionGeneration,
+			&user.TOTPSecret, &user.TOTPPendingSecret, &user.TOTPLastCounter, &recoveryCodes)
+	if err == sql.ErrNoRows {
+		return user, errNotFound
+	}
+	if err != nil {
+		return user, err
+	}
+	user.ID, _ = primitive.ObjectIDFromHex(id)
+	if err := json.Unmarshal([]byte(recoveryCodes), &user.RecoveryCodes); err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+// UpdateUser replaces the user which has same _id
+func (r *sqliteRepository) UpdateUser(user MongoUsers) error {
+	recoveryCodes, err := json.Marshal(user.RecoveryCodes)
+	if err != nil {
+		return err
+	}
+	if user.RecoveryCodes == nil {
+		recoveryCodes = []byte("[]")
+	}
+	res, err := r.db.Exec("UPDATE users SET user_id = ?, name = ?, password = ?, session_generation = ?, totp_secret = ?, totp_pending_secret = ?, totp_last_counter = ?, recovery_codes = ? WHERE id = ?",
+		user.UserID, user.Name, user.PassWord, user.SessionGeneration,
+		user.TOTPSecret, user.TOTPPendingSecret, user.TOTPLastCounter, string(recoveryCodes), user.ID.Hex())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// FindByID returns an entry by _id
+func (r *sqliteRepository) FindByID(id primitive.ObjectID) (MongoEntries, error) {
+	return r.findOne("id = ?", id.Hex())
+}
+
+// FindByCode returns an entry by entryCode
+func (r *sqliteRepository) FindByCode(entryCode string) (MongoEntries, error) {
+	return r.findOne("entry_code = ?", entryCode)
+}
+
+func (r *sqliteRepository) findOne(where string, args ...interface{}) (MongoEntries, error) {
+	rows, err := r.db.Query("SELECT "+sqliteEntryColumns+" FROM entries WHERE "+where, args...)
+	if err != nil {
+		return MongoEntries{}, err
+	}
+	results, err := r.scanEntries(rows)
+	if err != nil {
+		return MongoEntries{}, err
+	}
+	if len(results) == 0 {
+		return MongoEntries{}, errNotFound
+	}
+	return results[0], nil
+}
+
+// NextEntryID returns max entryId + 1
+func (r *sqliteRepository) NextEntryID() (int32, error) {
+	var next int32
+	err := r.db.QueryRow("SELECT COALESCE(MAX(entry_id), 0) + 1 FROM entries").Scan(&next)
+	return next, err
+}
+
+// Insert inserts an entry
+func (r *sqliteRepository) Insert(entry MongoEntries) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec("INSERT INTO entries ("+sqliteEntryColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		entry.ID.Hex(), entry.EntryID, entry.EntryCode, sqliteTime(entry.PublishDate), entry.Title, entry.Content,
+		entry.IsPublished, entry.AuthorID, sqliteTime(entry.CreatedAt), sqliteTime(entry.UpdatedAt))
+	if err != nil {
+		return err
+	}
+	if err := r.saveTags(tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Update replaces the entry which has same _id
+func (r *sqliteRepository) Update(entry MongoEntries) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec("UPDATE entries SET entry_id = ?, entry_code = ?, publish_date = ?, title = ?, content = ?, is_published = ?, author_id = ?, created_at = ?, updated_at = ? WHERE id = ?",
+		entry.EntryID, entry.EntryCode, sqliteTime(entry.PublishDate), entry.Title, entry.Content,
+		entry.IsPublished, entry.AuthorID, sqliteTime(entry.CreatedAt), sqliteTime(entry.UpdatedAt), entry.ID.Hex())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errNotFound
+	}
+	if _, err := tx.Exec("DELETE FROM entry_tags WHERE entry_id = ?", entry.ID.Hex()); err != nil {
+		return err
+	}
+	if err := r.saveTags(tx, entry); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (r *sqliteRepository) saveTags(tx *sql.Tx, entry MongoEntries) error {
+	for i, tag := range entry.Tag {
+		if _, err := tx.Exec("INSERT INTO entry_tags (entry_id, position, tag) VALUES (?, ?, ?)", entry.ID.Hex(), i, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplaceTags replaces tags of all entries which have any of from and tag metadata in one transaction
+func (r *sqliteRepository) ReplaceTags(from []string, to string, updatedAt time.Time) ([]MongoEntries, int, error) {
+	if len(from) == 0 {
+		return nil, 0, nil
+	}
+	args := make([]interface{}, len(from))
+	for i, v := range from {
+		args[i] = v
+	}
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(from)), ",")
+	rows, err := tx.Query("SELECT "+sqliteEntryColumns+" FROM entries WHERE id IN (SELECT entry_id FROM entry_tags WHERE tag IN ("+placeholders+")) ORDER BY publish_date DESC", args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	befores, err := scanSqliteEntries(tx, rows)
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, before := range befores {
+		entry := before
+		entry.Tag = replaceTagNames(before.Tag, from, to)
+		if _, err := tx.Exec("UPDATE entries SET updated_at = ? WHERE id = ?", sqliteTime(updatedAt), entry.ID.Hex()); err != nil {
+			return nil, 0, err
+		}
+		if _, err := tx.Exec("DELETE FROM entry_tags WHERE entry_id = ?", entry.ID.Hex()); err != nil {
+			return nil, 0, err
+		}
+		if err := r.saveTags(tx, entry); err != nil {
+			return nil, 0, err
+		}
+	}
+	tags, err := findSqliteTags(tx)
+	if err != nil {
+		return nil, 0, err
+	}
+	saves, deletes := replaceTagMetaDocs(tags, from, to)
+	for _, v := range saves {
+		if err := saveSqliteTag(tx, v); err != nil {
+			return nil, 0, err
+		}
+	}
+	for _, id := range deletes {
+		if _, err := tx.Exec("DELETE FROM tags WHERE id = ?", id.Hex()); err != nil {
+			return nil, 0, err
+		}
+	}
+	return befores, len(saves) + len(deletes), tx.Commit()
+}
+
+// Delete deletes an entry by _id (entry_tags are deleted by cascade)
+func (r *sqliteRepository) Delete(id primitive.ObjectID) error {
+	res, err := r.db.Exec("DELETE FROM entries WHERE id = ?", id.Hex())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// InsertRevision inserts a revision (entry snapshot is stored as json)
+func (r *sqliteRepository) InsertRevision(revision MongoRevisions) error {
+	entry, err := json.Marshal(revision.Entry)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.Exec("INSERT INTO revisions (id, entry_object_id, revision, entry, saved_by, saved_at) VALUES (?, ?, ?, ?, ?, ?)",
+		revision.ID.Hex(), revision.EntryObjectID.Hex(), revision.Revision, string(entry), revision.SavedBy, sqliteTime(revision.SavedAt))
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique {
+		return errDuplicateRevision
+	}
+	return err
+}
+
+// FindRevisions returns revisions of the entry ordered by revision desc
+func (r *sqliteRepository) FindRevisions(entryObjectID primitive.ObjectID) ([]MongoRevisions, error) {
+	rows, err := r.db.Query("SELECT id, entry_object_id, revision, entry, saved_by, saved_at FROM revisions WHERE entry_object_id = ? ORDER BY revision DESC",
+		entryObjectID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	return scanRevisions(rows)
+}
+
+// FindRevision returns a revision by _id
+func (r *sqliteRepository) FindRevision(id primitive.ObjectID) (MongoRevisions, error) {
+	rows, err := r.db.Query("SELECT id, entry_object_id, revision, entry, saved_by, saved_at FROM revisions WHERE id = ?", id.Hex())
+	if err != nil {
+		return MongoRevisions{}, err
+	}
+	results, err := scanRevisions(rows)
+	if err != nil {
+		return MongoRevisions{}, err
+	}
+	if len(results) == 0 {
+		return MongoRevisions{}, errNotFound
+	}
+	return results[0], nil
+}
+
+func scanRevisions(rows *sql.Rows) ([]MongoRevisions, error) {
+	var results []MongoRevisions
+	defer rows.Close()
+	for rows.Next() {
+		var result MongoRevisions
+		var id, entryObjectID, entry, savedAt string
+		if err := rows.Scan(&id, &entryObjectID, &result.Revision, &entry, &result.SavedBy, &savedAt); err != nil {
+			return results, err
+		}
+		result.SavedAt = parseSqliteTime(savedAt)
+		if err := json.Unmarshal([]byte(entry), &result.Entry); err != nil {
+			return results, err
+		}
+		result.ID, _ = primitive.ObjectIDFromHex(id)
+		result.EntryObjectID, _ = primitive.ObjectIDFromHex(entryObjectID)
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// FindTags returns all tags ordered by name
+func (r *sqliteRepository) FindTags() ([]MongoTags, error) {
+	return findSqliteTags(r.db)
+}
+
+func findSqliteTags(q sqliteQuerier) ([]MongoTags, error) {
+	rows, err := q.Query("SELECT id, name, slug, description, parent FROM tags ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var results []MongoTags
+	for rows.Next() {
+		var result MongoTags
+		var id string
+		if err := rows.Scan(&id, &result.Name, &result.Slug, &result.Description, &result.Parent); err != nil {
+			return results, err
+		}
+		result.ID, _ = primitive.ObjectIDFromHex(id)
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// SaveTag inserts or replaces the tag which has same _id
+func (r *sqliteRepository) SaveTag(tag MongoTags) error {
+	return saveSqliteTag(r.db, tag)
+}
+
+func saveSqliteTag(q sqliteQuerier, tag MongoTags) error {
+	_, err := q.Exec("INSERT INTO tags (id, name, slug, description, parent) VALUES (?, ?, ?, ?, ?) "+
+		"ON CONFLICT (id) DO UPDATE SET name = excluded.name, slug = excluded.slug, description = excluded.description, parent = excluded.parent",
+		tag.ID.Hex(), tag.Name, tag.Slug, tag.Description, tag.Parent)
+	return err
+}
+
+// DeleteTag deletes a tag by _id
+func (r *sqliteRepository) DeleteTag(id primitive.ObjectID) error {
+	res, err := r.db.Exec("DELETE FROM tags WHERE id = ?", id.Hex())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+const sqliteSessionColumns = "id, user_id, data, remote_ip, user_agent, created_at, updated_at, expires_at"
+
+func (r *sqliteRepository) scanSessions(rows *sql.Rows) ([]MongoSessions, error) {
+	defer rows.Close()
+	var results []MongoSessions
+	for rows.Next() {
+		var result MongoSessions
+		var createdAt, updatedAt, expiresAt string
+		if err := rows.Scan(&result.ID, &result.UserID, &result.Data, &result.RemoteIP, &result.UserAgent, &createdAt, &updatedAt, &expiresAt); err != nil {
+			return results, err
+		}
+		result.CreatedAt = parseSqliteTime(createdAt)
+		result.UpdatedAt = parseSqliteTime(updatedAt)
+		result.ExpiresAt = parseSqliteTime(expiresAt)
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+// FindSession returns a session which is not expired by id
+func (r *sqliteRepository) FindSession(id string, now time.Time) (MongoSessions, error) {
+	rows, err := r.db.Query("SELECT "+sqliteSessionColumns+" FROM sessions WHERE id = ? AND expires_at > ?", id, sqliteTime(now))
+	if err != nil {
+		return MongoSessions{}, err
+	}
+	results, err := r.scanSessions(rows)
+	if err != nil {
+		return MongoSessions{}, err
+	}
+	if len(results) == 0 {
+		return MongoSessions{}, errNotFound
+	}
+	return results[0], nil
+}
+
+// FindSessions returns sessions which are not expired ordered by updatedAt desc
+func (r *sqliteRepository) FindSessions(now time.Time) ([]MongoSessions, error) {
+	rows, err := r.db.Query("SELECT "+sqliteSessionColumns+" FROM sessions WHERE expires_at > ? ORDER BY updated_at DESC", sqliteTime(now))
+	if err != nil {
+		return nil, err
+	}
+	return r.scanSessions(rows)
+}
+
+// SaveSession inserts or replaces the session which has same id (created_at is kept)
+func (r *sqliteRepository) SaveSession(session MongoSessions) error {
+	_, err := r.db.Exec("INSERT INTO sessions ("+sqliteSessionColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?) "+
+		"ON CONFLICT (id) DO UPDATE SET user_id = excluded.user_id, data = excluded.data, remote_ip = excluded.remote_ip, "+
+		"user_agent = excluded.user_agent, updated_at = excluded.updated_at, expires_at = excluded.expires_at",
+		session.ID, session.UserID, session.Data, session.RemoteIP, session.UserAgent,
+		sqliteTime(session.CreatedAt), sqliteTime(session.UpdatedAt), sqliteTime(session.ExpiresAt))
+	return err
+}
+
+// DeleteSession deletes a session by id
+func (r *sqliteRepository) DeleteSession(id string) error {
+	res, err := r.db.Exec("DELETE FROM sessions WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+// DeleteExpiredSessions deletes sessions which expired
+func (r *sqliteRepository) DeleteExpiredSessions(now time.Time) (int, error) {
+	res, err := r.db.Exec("DELETE FROM sessions WHERE expires_at <= ?", sqliteTime(now))
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newTestSqliteRepository(t *testing.T) *sqliteRepository {
+	t.Helper()
+	setupTestSettings(t, "")
+	s := settings
+	s.DBPath = filepath.Join(t.TempDir(), "doblog.db")
+	r, err := newSqliteRepository(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestSqliteRepositoryReplaceTags(t *testing.T) {
+	r := newTestSqliteRepository(t)
+	now := time.Now()
+	for _, v := range testEntries(3, now) {
+		v.Tag = []string{"go", "web"}
+		if err := r.Insert(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tags := []MongoTags{
+		{ID: primitive.NewObjectID(), Name: "go", Slug: "go"},
+		{ID: primitive.NewObjectID(), Name: "web", Slug: "web", Parent: "go"},
+	}
+	for _, v := range tags {
+		if err := r.SaveTag(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	befores, metas, err := r.ReplaceTags([]string{"go"}, "golang", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(befores) != 3 || metas != 2 {
+		t.Fatalf("ReplaceTags = %d entries, %d metas", len(befores), metas)
+	}
+	if !equalStrings(befores[0].Tag, []string{"go", "web"}) {
+		t.Errorf("before tags = %v", befores[0].Tag)
+	}
+	entries, _ := r.FindPublishedByTag("golang", now, 0, 0)
+	if len(entries) != 3 || !equalStrings(entries[0].Tag, []string{"golang", "web"}) {
+		t.Errorf("entries after ReplaceTags = %v", entries)
+	}
+	saved, _ := r.FindTags()
+	if got := tagMetaNames(saved); !equalStrings(got, []string{"golang:", "web:golang"}) {
+		t.Errorf("tags = %v", got)
+	}
+}
+
+func TestSqliteRepositoryDuplicateRevision(t *testing.T) {
+	r := newTestSqliteRepository(t)
+	id := primitive.NewObjectID()
+	revision := MongoRevisions{ID: primitive.NewObjectID(), EntryObjectID: id, Revision: 1}
+	if err := r.InsertRevision(revision); err != nil {
+		t.Fatal(err)
+	}
+	revision.ID = primitive.NewObjectID()
+	if err := r.InsertRevision(revision); err != errDuplicateRevision {
+		t.Errorf("err = %v, want errDuplicateRevision", err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"hash/crc32"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/labstack/echo/v4"
+)
+
+// key of cacheTags (name -> MongoTags)
+const cacheKeyTagMetas = "metas"
+
+// slugはURLの1セグメントになるので小文字英数字と-のみ
+var (
+	tagSlugPattern        = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+	tagSlugInvalidPattern = regexp.MustCompile(`[^a-z0-9]+`)
+)
+
+// slug generated from tag name
+// ASCII以外を含む名前は変換で情報が落ちるので、名前のhashを付けて他のタグと重ならないようにする
+func autoTagSlug(name string) string {
+	slug := strings.Trim(tagSlugInvalidPattern.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	isASCII := true
+	for _, r := range name {
+		if r > unicode.MaxASCII {
+			isASCII = false
+			break
+		}
+	}
+	if slug != "" && isASCII {
+		return slug
+	}
+	if slug == "" {
+		return "tag-" + tagNameHash(name)
+	}
+	return slug + "-" + tagNameHash(name)
+}
+
+func tagNameHash(name string) string {
+	return fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(name)))
+}
+
+// metadata of all tags (tags collection + tags of published entries), key = tag name
+// tags collectionに無いタグはslugを自動生成する
+func (s *server) getTagMetas() map[string]MongoTags {
+	// cache exists check & return
+	generation := s.cacheTags.Generation()
+	if val, ok := s.cacheTags.Get(cacheKeyTagMetas); ok {
+		return val.(map[string]MongoTags)
+	}
+	metas := make(map[string]MongoTags)
+	slugs := make(map[string]bool)
+	tags, err := s.tags.FindTags()
+	if err != nil {
+		appLog.Error("find tags error", "error", err)
+		return metas
+	}
+	for _, v := range tags {
+		if v.Slug == "" {
+			v.Slug = autoTagSlug(v.Name)
+		}
+		metas[v.Name] = v
+		slugs[v.Slug] = true
+	}
+	entries, err := s.entries.FindPublished(time.Now(), 0, 0)
+	if err != nil {
+		appLog.Error("find published entries error", "error", err)
+		return metas
+	}
+	var names []string
+	for _, entry := range entries {
+		for _, name := range entry.Tag {
+			if _, ok := metas[name]; !ok {
+				metas[name] = MongoTags{Name: name}
+				names = append(names, name)
+			}
+		}
+	}
+	// 重複した場合にどちらがhash付きになるかが変わらないように名前順で決める
+	sort.Strings(names)
+	for _, name := range names {
+		slug := autoTagSlug(name)
+		if slugs[slug] {
+			slug += "-" + tagNameHash(name)
+		}
+		slugs[slug] = true
+		metas[name] = MongoTags{Name: name, Slug: slug}
+	}
+	// save cache
+	s.cacheTags.Set(cacheKeyTagMetas, metas, generation)
+	return metas
+}
+
+// tag by slug
+func (s *server) findTagBySlug(slug string) (MongoTags, bool) {
+	for _, v := range s.getTagMetas() {
+		if v.Slug == slug {
+			return v, true
+		}
+	}
+	return MongoTags{}, false
+}
+
+// tag/:tagName parameter
+// echo v4.2はEscapedPathでroutingしてparamをdecodeしないので、ここで1回だけdecodeする (requestごとに1回だけ呼ぶ)
+func tagParam(c echo.Context) string {
+	param := c.Param("tagName")
+	if v, err := url.PathUnescape(param); err == nil {
+		return v
+	}
+	return param
+}
+
+// tag/:tagName parameter -> tag name (slug, 旧URLの場合はタグ名そのもの)
+func (s *server) tagNameByParam(param string) (string, bool) {
+	if tag, ok := s.findTagBySlug(param); ok {
+		return tag.Name, true
+	}
+	if _, ok := s.getTagMetas()[param]; ok {
+		return param, true
+	}
+	return "", false
+}
+
+// tag page uri
+func (s *server) tagURI(name string) string {
+	if tag, ok := s.getTagMetas()[name]; ok {
+		return tagPrefixURI + tag.Slug
+	}
+	return tagPrefixURI + autoTagSlug(name)
+}
+
+// child tags ordered by name
+func (s *server) childTags(name string) []TagItem {
+	var names []string
+	for _, v := range s.getTagMetas() {
+		if v.Parent == name {
+			names = append(names, v.Name)
+		}
+	}
+	sort.Strings(names)
+	return s.toTagItems(names)
+}
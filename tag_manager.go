@@ -0,0 +1,233 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TagInput - request body of manager tag api
+type TagInput struct {
+	// renameTag, deleteTag
+	Tag string `json:"tag"`
+	// mergeTags (sources)
+	Tags []string `json:"tags"`
+	// renameTag, mergeTags (new name)
+	To string `json:"to"`
+}
+
+// TagMetaInput - request body of saveTag
+type TagMetaInput struct {
+	Name        string `json:"name"`
+	Slug        string `json:"slug"`
+	Description string `json:"description"`
+	Parent      string `json:"parent"`
+}
+
+// replace names in from with to (to == "" removes them), order is kept and duplicates are removed
+func replaceTagNames(tags, from []string, to string) []string {
+	results := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	for _, v := range tags {
+		for _, f := range from {
+			if v == f {
+				v = to
+				break
+			}
+		}
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		results = append(results, v)
+	}
+	return results
+}
+
+func hasAnyTag(tags, names []string) bool {
+	for _, v := range tags {
+		for _, n := range names {
+			if v == n {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// trim and check a tag name (validateEntryInputと同じ制約)
+func validateTagName(field, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", &ValidationError{Field: field, Message: "required"}
+	}
+	if strings.Contains(name, "/") {
+		return "", &ValidationError{Field: field, Message: "'/' is not allowed"}
+	}
+	return name, nil
+}
+
+// rename a tag in all entries (同名のタグが既にある場合はmergeと同じ)
+func (s *server) renameTag(input TagInput, savedBy int32) (int, error) {
+	tag, err := validateTagName("tag", input.Tag)
+	if err != nil {
+		return 0, err
+	}
+	to, err := validateTagName("to", input.To)
+	if err != nil {
+		return 0, err
+	}
+	if tag == to {
+		return 0, &ValidationError{Field: "to", Message: "same as tag"}
+	}
+	return s.replaceTags([]string{tag}, to, savedBy)
+}
+
+// merge tags into one tag in all entries
+func (s *server) mergeTags(input TagInput, savedBy int32) (int, error) {
+	to, err := validateTagName("to", input.To)
+	if err != nil {
+		return 0, err
+	}
+	var from []string
+	for _, v := range input.Tags {
+		name, err := validateTagName("tags", v)
+		if err != nil {
+			return 0, err
+		}
+		if name != to {
+			from = append(from, name)
+		}
+	}
+	if len(from) == 0 {
+		return 0, &ValidationError{Field: "tags", Message: "required"}
+	}
+	return s.replaceTags(from, to, savedBy)
+}
+
+// remove a tag from all entries
+func (s *server) deleteTag(input TagInput, savedBy int32) (int, error) {
+	tag, err := validateTagName("tag", input.Tag)
+	if err != nil {
+		return 0, err
+	}
+	return s.replaceTags([]string{tag}, "", savedBy)
+}
+
+// replace tags and tag metadata and purge caches, returns number of updated entries
+// entryもmetadataも無いタグはerrNotFound
+func (s *server) replaceTags(from []string, to string, savedBy int32) (int, error) {
+	updatedAt := time.Now()
+	befores, metas, err := s.entries.ReplaceTags(from, to, updatedAt)
+	if err != nil {
+		return 0, err
+	}
+	if len(befores) == 0 && metas == 0 {
+		return 0, errNotFound
+	}
+	entries := make([]MongoEntries, 0, len(befores)*2)
+	for _, before := range befores {
+		entry := before
+		entry.Tag = replaceTagNames(before.Tag, from, to)
+		entry.UpdatedAt = updatedAt
+		entries = append(entries, before, entry)
+		s.saveRevisionOrLog(entry, savedBy, before)
+	}
+	// 旧タグ/新タグ両方のtag pageを破棄してtagsを作り直す (slugも変わるので全て破棄)
+	s.invalidateEntry(entries...)
+	s.purgeCache("", nil)
+	s.getTagsAll()
+	return len(befores), nil
+}
+
+// changes of tags collection documents by replacing from with to (to == "" removes them)
+// renameの場合のみmetadataを引き継ぐ (mergeや変更先に既にmetadataがある場合は変更先を残す). 親がfromの場合は変更先にする
+func replaceTagMetaDocs(tags []MongoTags, from []string, to string) ([]MongoTags, []primitive.ObjectID) {
+	var saves []MongoTags
+	var deletes []primitive.ObjectID
+	toExists := false
+	for _, v := range tags {
+		if v.Name == to {
+			toExists = true
+		}
+	}
+	for _, v := range tags {
+		switch {
+		case hasAnyTag([]string{v.Name}, from):
+			if to == "" || toExists || len(from) > 1 {
+				deletes = append(deletes, v.ID)
+				continue
+			}
+			v.Name = to
+			toExists = true
+			saves = append(saves, v)
+		case hasAnyTag([]string{v.Parent}, from):
+			v.Parent = to
+			if v.Parent == v.Name {
+				v.Parent = ""
+			}
+			saves = append(saves, v)
+		}
+	}
+	return saves, deletes
+}
+
+// all tags with metadata ordered by name
+func (s *server) getTagMetaList() []MongoTags {
+	var tags []MongoTags
+	for _, v := range s.getTagMetas() {
+		tags = append(tags, v)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+	return tags
+}
+
+// save slug, description and parent of a tag (slugが空の場合は自動生成)
+func (s *server) saveTagMeta(input TagMetaInput) (MongoTags, error) {
+	name, err := validateTagName("name", input.Name)
+	if err != nil {
+		return MongoTags{}, err
+	}
+	slug := strings.TrimSpace(input.Slug)
+	if slug == "" {
+		slug = autoTagSlug(name)
+	} else if !tagSlugPattern.MatchString(slug) {
+		return MongoTags{}, &ValidationError{Field: "slug", Message: "only lowercase alphanumeric and '-' are allowed"}
+	}
+	parent := strings.TrimSpace(input.Parent)
+	if parent != "" {
+		if parent, err = validateTagName("parent", parent); err != nil {
+			return MongoTags{}, err
+		}
+	}
+	metas := s.getTagMetas()
+	for _, v := range metas {
+		if v.Name != name && v.Slug == slug {
+			return MongoTags{}, &ValidationError{Field: "slug", Message: "already used"}
+		}
+	}
+	// 親を辿って自身に戻る場合は循環になる
+	for p, i := parent, 0; p != "" && i <= len(metas); p, i = metas[p].Parent, i+1 {
+		if p == name {
+			return MongoTags{}, &ValidationError{Field: "parent", Message: "circular reference"}
+		}
+	}
+	tag := metas[name]
+	if tag.ID.IsZero() {
+		tag.ID = primitive.NewObjectID()
+	}
+	tag.Name = name
+	tag.Slug = slug
+	tag.Description = strings.TrimSpace(input.Description)
+	tag.Parent = parent
+	if err := s.tags.SaveTag(tag); err != nil {
+		return MongoTags{}, err
+	}
+	// slugが変わるとcache済みのページ内のタグのURIも変わるので全て破棄
+	s.purgeCache("", nil)
+	return tag, nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReplaceTagNames(t *testing.T) {
+	tests := []struct {
+		name string
+		tags []string
+		from []string
+		to   string
+		want []string
+	}{
+		{"rename", []string{"a", "b"}, []string{"a"}, "x", []string{"x", "b"}},
+		{"merge keeps order", []string{"a", "b", "c"}, []string{"a", "c"}, "b", []string{"b"}},
+		{"delete", []string{"a", "b"}, []string{"b"}, "", []string{"a"}},
+		{"not included", []string{"a"}, []string{"b"}, "x", []string{"a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := replaceTagNames(tt.tags, tt.from, tt.to); !equalStrings(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// tag metadata as name:parent, ordered by name
+func tagMetaNames(tags []MongoTags) []string {
+	names := []string{}
+	for _, v := range tags {
+		names = append(names, v.Name+":"+v.Parent)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestReplaceTagsMetadata(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name    string
+		from    []string
+		to      string
+		updated int
+		err     error
+		want    []string
+	}{
+		{"rename keeps metadata and children", []string{"go"}, "golang", 2, nil, []string{"golang:", "web:golang"}},
+		{"delete removes metadata", []string{"go"}, "", 2, nil, []string{"web:"}},
+		{"merge into tag with metadata", []string{"go"}, "web", 2, nil, []string{"web:"}},
+		// entryは無いがmetadataはある
+		{"metadata only", []string{"web"}, "frontend", 0, nil, []string{"frontend:go", "go:"}},
+		{"unknown tag", []string{"nothing"}, "x", 0, errNotFound, []string{"go:", "web:go"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository(testEntries(2, now), nil)
+			repo.tags = []MongoTags{
+				{ID: primitive.NewObjectID(), Name: "go", Slug: "go"},
+				{ID: primitive.NewObjectID(), Name: "web", Slug: "web", Parent: "go"},
+			}
+			s, _ := newTestServer(t, repo)
+			updated, err := s.replaceTags(tt.from, tt.to, 1)
+			if err != tt.err || updated != tt.updated {
+				t.Fatalf("replaceTags = %d, %v, want %d, %v", updated, err, tt.updated, tt.err)
+			}
+			tags, _ := repo.FindTags()
+			if got := tagMetaNames(tags); !equalStrings(got, tt.want) {
+				t.Errorf("tags = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
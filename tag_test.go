@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTagParam(t *testing.T) {
+	now := time.Now()
+	entries := testEntries(3, now)
+	entries[0].Tag = []string{"日記"}
+	entries[1].Tag = []string{"50%25off"}
+	entries[2].Tag = []string{"Go Lang"}
+	s, e := newTestServer(t, newMemoryRepository(entries, nil))
+	tests := []struct {
+		name     string
+		path     string
+		status   int
+		location string
+	}{
+		{"slug", "/tag/go-lang", http.StatusOK, ""},
+		{"old url of non-ascii tag", "/tag/%E6%97%A5%E8%A8%98", http.StatusMovedPermanently, s.tagURI("日記")},
+		{"old url with space", "/tag/Go%20Lang", http.StatusMovedPermanently, "/tag/go-lang"},
+		// 2回decodeすると"50%off"になる
+		{"decoded once", "/tag/50%2525off", http.StatusMovedPermanently, s.tagURI("50%25off")},
+		{"unknown", "/tag/nothing", http.StatusNotFound, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := newTestClient(e).get(tt.path)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if location := rec.Header().Get("Location"); location != tt.location {
+				t.Errorf("location = %q, want %q", location, tt.location)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"html/template"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/russross/blackfriday/v2"
@@ -24,11 +25,17 @@ func (t *templateRenderer) Render(w io.Writer, name string, data interface{}, c
 	return t.templates.ExecuteTemplate(w, name, data)
 }
 
+// template exists check (status別のerror page等)
+func (t *templateRenderer) hasTemplate(name string) bool {
+	return t.templates.Lookup(name) != nil
+}
+
 // main funcに渡す
 func getTemplateRenderer() *templateRenderer {
 	fnc := template.FuncMap{
 		"toMarkdown": toMarkdown,
 		"dtFormat":   dtFormat,
+		"dateFormat": dateFormat,
 	}
 	return &templateRenderer{
 		templates: template.Must(template.New("").Funcs(fnc).ParseGlob("templates/*.html")),
@@ -59,8 +66,7 @@ func toMarkdown(str string, isLists bool, uri string, title string) template.HTM
 	return template.HTML(blackfriday.Run([]byte(buffer)))
 }
 
-// datetime formatter (golangでは何故か具体的な下記日時を指定してyyyy-mm-ddフォーマットをを実現する)(が、mongoでは多分使わない)
-func dtFormat(dateTime string) string {
-	//return dateTime.Format("2006-01-02")
-	return string([]rune(dateTime)[:10])
+// datetime formatter (yyyy-mm-dd) 詳細はdateFormat(datetime.go)を参照
+func dtFormat(dateTime time.Time) string {
+	return dateFormat(dateTime, "date")
 }
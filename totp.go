@@ -0,0 +1,399 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"github.com/labstack/echo/v4"
+	qrcode "github.com/skip2/go-qrcode"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TOTP (RFC 6238) - HMAC-SHA1, 30秒, 6桁 (Google Authenticator等の標準)
+const (
+	totpPeriod      = 30
+	totpDigits      = 6
+	totpSecretBytes = 20
+	// 前後1stepのずれを許容する
+	totpSkew          = 1
+	totpQRCodeSize    = 256
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 10
+	// password確認後、codeの入力を待つ時間と回数
+	totpPendingTTL      = 5 * time.Minute
+	totpPendingAttempts = 5
+)
+
+// session keys of the second login step (passwordは確認済み, TOTPは未確認)
+const (
+	TOTPUserIDSessionKey   = "totp_user_id"
+	TOTPIssuedAtSessionKey = "totp_issued_at"
+	TOTPAttemptsSessionKey = "totp_attempts"
+)
+
+var (
+	errTOTPEnabled      = errors.New("two-factor authentication is already enabled")
+	errTOTPDisabled     = errors.New("two-factor authentication is not enabled")
+	errTOTPNotStarted   = errors.New("call beginTOTP first")
+	errTOTPInvalidCode  = errors.New("invalid authentication code")
+	errTOTPPendingLogin = errors.New("no pending login")
+	errTOTPThrottled    = errors.New("too many failed attempts, please try again later")
+)
+
+// base32 without padding (authenticator appsはpaddingなしを想定している)
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// verifyTOTPCodeとlast counterの更新を同時に行う (同じcodeの並行利用を防ぐ)
+var totpMu sync.Mutex
+
+// TOTPSetup - response of beginTOTP
+type TOTPSetup struct {
+	Secret string `json:"secret"`
+	// otpauth://totp/...
+	URI string `json:"uri"`
+	// data:image/png;base64,...
+	QRCode string `json:"qrCode"`
+}
+
+// TOTPStatus - response of getTOTPStatus
+type TOTPStatus struct {
+	Enabled           bool `json:"enabled"`
+	RecoveryCodesLeft int  `json:"recoveryCodesLeft"`
+}
+
+// random base32 secret
+func newTOTPSecret() (string, error) {
+	b := make([]byte, totpSecretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// code of the time step (RFC 4226 dynamic truncation)
+func totpCode(key []byte, counter int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(counter))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, value%mod)
+}
+
+// check the code, returns the matched time step
+// lastCounter以前のstepは使用済みとして拒否する (replay対策)
+func verifyTOTPCode(secret, code string, now time.Time, lastCounter int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(key) == 0 || len(code) != totpDigits {
+		return 0, false
+	}
+	current := now.Unix() / totpPeriod
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, counter)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+	return 0, false
+}
+
+// otpauth://totp/Issuer:name?secret=...&issuer=...
+func totpProvisioningURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	return "otpauth://totp/" + url.PathEscape(issuer) + ":" + url.PathEscape(account) + "?" + v.Encode()
+}
+
+// recovery codes (xxxxx-xxxxx) and their hashes
+// randomで十分な長さがあるのでbcryptではなくsha256で保存する
+func newRecoveryCodes() ([]string, []string, error) {
+	var codes, hashes []string
+	for i := 0; i < recoveryCodeCount; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(b))[:10]
+		codes = append(codes, code[:5]+"-"+code[5:])
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// hash of a recovery code (ハイフン, 空白, 大文字小文字は区別しない)
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+// check the TOTP code or a recovery code and update the user (使用したrecovery codeは削除する)
+func (s *server) verifySecondFactor(user MongoUsers, code string) (MongoUsers, error) {
+	totpMu.Lock()
+	defer totpMu.Unlock()
+	// 他のrequestで更新されている場合があるので読み直す
+	user, err := s.users.FindUserByID(user.UserID)
+	if err != nil {
+		return user, err
+	}
+	code = strings.TrimSpace(code)
+	if counter, ok := verifyTOTPCode(user.TOTPSecret, code, time.Now(), user.TOTPLastCounter); ok {
+		user.TOTPLastCounter = counter
+		return user, s.users.UpdateUser(user)
+	}
+	hash := hashRecoveryCode(code)
+	for i, v := range user.RecoveryCodes {
+		if subtle.ConstantTimeCompare([]byte(v), []byte(hash)) == 1 {
+			codes := append([]string(nil), user.RecoveryCodes[:i]...)
+			user.RecoveryCodes = append(codes, user.RecoveryCodes[i+1:]...)
+			return user, s.users.UpdateUser(user)
+		}
+	}
+	return user, errTOTPInvalidCode
+}
+
+// count an attempt of the loggedin user before checking the password or the code ([login] settings)
+// ログイン後もcodeを総当たりできないように、ログインと同じusernameの回数で制限する
+func (s *server) beginUserAttempt(c echo.Context, user MongoUsers, now time.Time) error {
+	reason, retryAt, err := s.loginLimiter.beginUser(user.Name, now)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		s.recordLoginFailure(c, user.Name, reason, now)
+		requestLogger(c).Warn("totp attempt throttled", "user_id", user.UserID, "remote_ip", c.RealIP(), "reason", reason, "retry_at", retryAt)
+		return errTOTPThrottled
+	}
+	return nil
+}
+
+// finish the attempt: reason == "" resets the counter, otherwise records the failure
+func (s *server) endUserAttempt(c echo.Context, user MongoUsers, reason string, now time.Time) {
+	if reason != "" {
+		s.recordLoginFailure(c, user.Name, reason, now)
+		requestLogger(c).Warn("totp attempt failed", "user_id", user.UserID, "remote_ip", c.RealIP(), "reason", reason)
+		return
+	}
+	if err := s.loginLimiter.userSucceeded(user.Name); err != nil {
+		requestLogger(c).Error("login throttle reset error", "user_id", user.UserID, "error", err)
+	}
+}
+
+// user of the request (loggedin user)
+func (s *server) loggedinUser(c echo.Context) (MongoUsers, error) {
+	user, err := s.users.FindUserByID(loggedinUserID(c))
+	if err == errNotFound {
+		return user, errNotLoggedin
+	}
+	return user, err
+}
+
+// TOTP status of the loggedin user
+func (s *server) getTOTPStatus(c echo.Context) (TOTPStatus, error) {
+	user, err := s.loggedinUser(c)
+	if err != nil {
+		return TOTPStatus{}, err
+	}
+	return TOTPStatus{Enabled: user.TOTPSecret != "", RecoveryCodesLeft: len(user.RecoveryCodes)}, nil
+}
+
+// start enrollment: create a pending secret (confirmTOTPで有効になるまでログインには使わない)
+func (s *server) beginTOTP(c echo.Context) (TOTPSetup, error) {
+	user, err := s.loggedinUser(c)
+	if err != nil {
+		return TOTPSetup{}, err
+	}
+	if user.TOTPSecret != "" {
+		return TOTPSetup{}, errTOTPEnabled
+	}
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return TOTPSetup{}, err
+	}
+	user.TOTPPendingSecret = secret
+	if err := s.users.UpdateUser(user); err != nil {
+		return TOTPSetup{}, err
+	}
+	uri := totpProvisioningURI(settings.BlogTitle, user.Name, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, totpQRCodeSize)
+	if err != nil {
+		return TOTPSetup{}, err
+	}
+	return TOTPSetup{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// finish enrollment with a code from the app, returns recovery codes (平文を返すのはこの1回のみ)
+// 他のsessionは全てログアウトする
+func (s *server) confirmTOTP(c echo.Context, code string) ([]string, error) {
+	user, err := s.loggedinUser(c)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPSecret != "" {
+		return nil, errTOTPEnabled
+	}
+	if user.TOTPPendingSecret == "" {
+		return nil, errTOTPNotStarted
+	}
+	counter, ok := verifyTOTPCode(user.TOTPPendingSecret, strings.TrimSpace(code), time.Now(), 0)
+	if !ok {
+		return nil, errTOTPInvalidCode
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	user.TOTPSecret = user.TOTPPendingSecret
+	user.TOTPPendingSecret = ""
+	user.TOTPLastCounter = counter
+	user.RecoveryCodes = hashes
+	if err := s.renewUserSessions(c, user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// disable TOTP (passwordと現在のcode or recovery codeが必要)
+func (s *server) disableTOTP(c echo.Context, password, code string) error {
+	user, err := s.loggedinUser(c)
+	if err != nil {
+		return err
+	}
+	if user.TOTPSecret == "" {
+		return errTOTPDisabled
+	}
+	now := time.Now()
+	if err := s.beginUserAttempt(c, user, now); err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.PassWord), []byte(password)) != nil {
+		s.endUserAttempt(c, user, LoginFailureInvalid, now)
+		return errPasswordMismatch
+	}
+	user, err = s.verifySecondFactor(user, code)
+	if err == errTOTPInvalidCode {
+		s.endUserAttempt(c, user, LoginFailureInvalidCode, now)
+	}
+	if err != nil {
+		return err
+	}
+	s.endUserAttempt(c, user, "", now)
+	user.TOTPSecret = ""
+	user.TOTPPendingSecret = ""
+	user.TOTPLastCounter = 0
+	user.RecoveryCodes = nil
+	return s.users.UpdateUser(user)
+}
+
+// replace recovery codes (現在のcodeが必要)
+func (s *server) regenerateRecoveryCodes(c echo.Context, code string) ([]string, error) {
+	user, err := s.loggedinUser(c)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPSecret == "" {
+		return nil, errTOTPDisabled
+	}
+	now := time.Now()
+	if err := s.beginUserAttempt(c, user, now); err != nil {
+		return nil, err
+	}
+	user, err = s.verifySecondFactor(user, code)
+	if err == errTOTPInvalidCode {
+		s.endUserAttempt(c, user, LoginFailureInvalidCode, now)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.endUserAttempt(c, user, "", now)
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	user.RecoveryCodes = hashes
+	if err := s.users.UpdateUser(user); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// password確認済みのuserをsessionに保存し、code入力画面へ
+func savePendingTOTPSession(c echo.Context, user MongoUsers) error {
+	ses, err := loadSession(c)
+	if err != nil {
+		return err
+	}
+	ses.Options = getSessionsOption()
+	ses.Values[TOTPUserIDSessionKey] = user.UserID
+	ses.Values[TOTPIssuedAtSessionKey] = time.Now().Unix()
+	ses.Values[TOTPAttemptsSessionKey] = 0
+	return ses.Save(c.Request(), c.Response())
+}
+
+// user waiting for the second step (期限切れ, 回数超過の場合はerrTOTPPendingLogin)
+func (s *server) pendingTOTPUser(c echo.Context) (MongoUsers, error) {
+	ses, err := loadSession(c)
+	if err != nil {
+		return MongoUsers{}, err
+	}
+	userID, _ := ses.Values[TOTPUserIDSessionKey].(int32)
+	issuedAt, _ := ses.Values[TOTPIssuedAtSessionKey].(int64)
+	attempts, _ := ses.Values[TOTPAttemptsSessionKey].(int)
+	if userID == 0 || time.Since(time.Unix(issuedAt, 0)) > totpPendingTTL || attempts >= totpPendingAttempts {
+		return MongoUsers{}, errTOTPPendingLogin
+	}
+	user, err := s.users.FindUserByID(userID)
+	if err == errNotFound {
+		return user, errTOTPPendingLogin
+	}
+	return user, err
+}
+
+// count a wrong code of the second step
+func countPendingTOTPAttempt(c echo.Context) error {
+	ses, err := loadSession(c)
+	if err != nil {
+		return err
+	}
+	attempts, _ := ses.Values[TOTPAttemptsSessionKey].(int)
+	ses.Values[TOTPAttemptsSessionKey] = attempts + 1
+	ses.Options = getSessionsOption()
+	return ses.Save(c.Request(), c.Response())
+}
+
+// remove values of the second step
+func clearPendingTOTPSession(ses *sessions.Session) {
+	for _, key := range []string{TOTPUserIDSessionKey, TOTPIssuedAtSessionKey, TOTPAttemptsSessionKey} {
+		delete(ses.Values, key)
+	}
+}
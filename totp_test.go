@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// RFC 6238 Appendix B (SHA1) の下6桁
+func TestTOTPCode(t *testing.T) {
+	key := []byte("12345678901234567890")
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("totpCode(T=%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyTOTPCode(t *testing.T) {
+	key := []byte("12345678901234567890")
+	secret := totpEncoding.EncodeToString(key)
+	now := time.Unix(1111111111, 0)
+	current := now.Unix() / totpPeriod
+	tests := []struct {
+		name        string
+		secret      string
+		code        string
+		lastCounter int64
+		counter     int64
+		ok          bool
+	}{
+		{"current step", secret, totpCode(key, current), 0, current, true},
+		{"previous step", secret, totpCode(key, current-1), 0, current - 1, true},
+		{"next step", secret, totpCode(key, current+1), 0, current + 1, true},
+		{"out of skew", secret, totpCode(key, current-2), 0, 0, false},
+		// 使用済みのstep
+		{"replay", secret, totpCode(key, current), current, 0, false},
+		{"older than last", secret, totpCode(key, current-1), current - 1, 0, false},
+		{"lowercase secret", strings.ToLower(secret), totpCode(key, current), 0, current, true},
+		{"wrong code", secret, "000000", 0, 0, false},
+		{"short code", secret, totpCode(key, current)[:5], 0, 0, false},
+		{"invalid secret", "not base32!", totpCode(key, current), 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := verifyTOTPCode(tt.secret, tt.code, now, tt.lastCounter)
+			if ok != tt.ok || counter != tt.counter {
+				t.Errorf("verifyTOTPCode = %d, %v, want %d, %v", counter, ok, tt.counter, tt.ok)
+			}
+		})
+	}
+}
+
+func TestHashRecoveryCode(t *testing.T) {
+	want := hashRecoveryCode("abcde-fghij")
+	for _, v := range []string{"abcdefghij", "ABCDE-FGHIJ", "abcde fghij", " abcde-fghij "} {
+		if got := hashRecoveryCode(v); got != want {
+			t.Errorf("hashRecoveryCode(%q) = %s, want %s", v, got, want)
+		}
+	}
+	if hashRecoveryCode("abcde-fghik") == want {
+		t.Error("different codes have the same hash")
+	}
+}
+
+// ログイン後のTOTP操作もusernameの失敗回数で制限する
+func TestTOTPAPIThrottled(t *testing.T) {
+	tests := []struct {
+		name  string
+		param string
+		body  string
+		err   error
+	}{
+		{"regenerate recovery codes", "regenerateRecoveryCodes", `{"code":"000000"}`, errTOTPInvalidCode},
+		{"disable with wrong code", "disableTOTP", `{"password":"password","code":"000000"}`, errTOTPInvalidCode},
+		{"disable with wrong password", "disableTOTP", `{"password":"wrong","code":"000000"}`, errPasswordMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := newMemoryRepository(nil, []MongoUsers{testUser(t)})
+			_, e := newTestServer(t, repo)
+			tc, token := loginTestClient(t, e)
+			secret, err := newTOTPSecret()
+			if err != nil {
+				t.Fatal(err)
+			}
+			user, _ := repo.FindUserByID(1)
+			user.TOTPSecret = secret
+			if err := repo.UpdateUser(user); err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i <= loginFreeAttempts; i++ {
+				req := httptest.NewRequest(http.MethodPost, "/backend/manager/api/"+tt.param, strings.NewReader(tt.body))
+				req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+				req.Header.Set(HeaderXCSRFToken, token)
+				rec := tc.do(req)
+				token = rec.Header().Get(HeaderXCSRFToken)
+				var res struct {
+					Error string `json:"error"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+					t.Fatalf("%d: %v", rec.Code, err)
+				}
+				want := tt.err
+				if i == loginFreeAttempts {
+					want = errTOTPThrottled
+				}
+				if res.Error != want.Error() {
+					t.Fatalf("attempt %d: error = %q, want %q", i+1, res.Error, want)
+				}
+			}
+			// secretは変わらない
+			if user, _ := repo.FindUserByID(1); user.TOTPSecret != secret {
+				t.Error("totp is disabled")
+			}
+		})
+	}
+}